@@ -85,24 +85,11 @@ func FetchUserByUsername(username string) (models.User, string, error) {
 	return models.User{}, "", errors.New("User not found that matches given username")
 }
 
-// StoreRefreshToken : create and add refresh token to our db
-func StoreRefreshToken() (jti string, err error) {
-	jti, err = randomstrings.GenerateRandomString(32)
-	if err != nil {
-		return jti, err
-	}
-
-	// check to make sure our jti is unique
-	for refreshTokens[jti] != "" {
-		jti, err = randomstrings.GenerateRandomString(32)
-		if err != nil {
-			return jti, err
-		}
-	}
-
+// RotateRefreshToken : add the new refresh token to our db, and remove the one it replaces
+func RotateRefreshToken(previousJti string, jti string) error {
+	delete(refreshTokens, previousJti)
 	refreshTokens[jti] = "valid"
-
-	return jti, err
+	return nil
 }
 
 // DeleteRefreshToken : remove refresh token from db
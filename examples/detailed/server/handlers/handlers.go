@@ -34,7 +34,10 @@ func InitHandlers() error {
 	restrictedRoute.SetErrorHandler(myErrorHandler)
 
 	restrictedRoute.SetRevokeTokenFunction(db.DeleteRefreshToken)
-	restrictedRoute.SetCheckTokenIdFunction(db.CheckRefreshToken)
+	restrictedRoute.SetRotateTokenIdFunction(db.RotateRefreshToken)
+	restrictedRoute.SetCheckTokenIdFunction(func(claims *jwt.ClaimsType) bool {
+		return db.CheckRefreshToken(claims.ID)
+	})
 
 	http.Handle("/", alice.New(recoverHandler).ThenFunc(loginHandler))
 	http.Handle("/register", alice.New(recoverHandler).ThenFunc(registerHandler))
@@ -94,14 +97,9 @@ var loginHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request)
 		} else {
 			// no login err
 			// now generate credentials for this user
-			claimsId, idErr := db.StoreRefreshToken()
-			if idErr != nil {
-				http.Error(w, http.StatusText(500), 500)
-			}
-
+			// the jti of the refresh token is generated, and whitelisted by db.RotateRefreshToken
 			claims := jwt.ClaimsType{}
 			claims.StandardClaims.Subject = uuid
-			claims.StandardClaims.Id = claimsId
 			claims.CustomClaims = make(map[string]interface{})
 			claims.CustomClaims["Role"] = user.Role
 
@@ -142,14 +140,9 @@ var registerHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Reque
 			log.Println("uuid: " + uuid)
 
 			// now generate cookies for this user
-			claimsId, idErr := db.StoreRefreshToken()
-			if idErr != nil {
-				http.Error(w, http.StatusText(500), 500)
-			}
-
+			// the jti of the refresh token is generated, and whitelisted by db.RotateRefreshToken
 			claims := jwt.ClaimsType{}
 			claims.StandardClaims.Subject = uuid
-			claims.StandardClaims.Id = claimsId
 			claims.CustomClaims = make(map[string]interface{})
 			claims.CustomClaims["Role"] = role
 
@@ -0,0 +1,422 @@
+package jwt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultAuditLogMaxSize = 100 << 20
+
+// minAuditLogKeySize : the size of the key of the chain, as a HMAC-SHA256 key
+const minAuditLogKeySize = 32
+
+// macField : how the mac closes every line of the audit log
+const macField = `,"mac":"`
+
+// ErrAuditLogTampered : the audit log has been edited, truncated or reordered
+var ErrAuditLogTampered = errors.New("audit log has been tampered with")
+
+// ErrAuditLogTorn : the audit log ends with a record that was only partly written, e.g. when
+// the process crashed while writing it. NewAuditLog cuts it, and records that it did.
+var ErrAuditLogTorn = errors.New("audit log ends with a torn record")
+
+// AuditLogRecovered : a torn record was cut from the end of the audit log when it was opened
+const AuditLogRecovered EventType = "audit_log_recovered"
+
+// AuditLogOptions : how the audit log is written
+type AuditLogOptions struct {
+	// Key : the HMAC-SHA256 key the chain is made with, at least 32 bytes. Keep it away from the
+	// log, so that whoever can write the log can't rebuild the chain.
+	Key []byte
+	// MaxSize : the size, in bytes, a file of the log is rotated at; defaults to 100 MB
+	MaxSize int64
+	// FailClosed : refuse the requests whose events can't be recorded, instead of only logging
+	// the error
+	FailClosed bool
+}
+
+// AuditRecord : a line of the audit log. Every record holds the mac of the previous one,
+// so no record can be edited, removed or reordered without breaking the chain.
+type AuditRecord struct {
+	Seq                    uint64    `json:"seq"`
+	Time                   time.Time `json:"time"`
+	Event                  EventType `json:"event"`
+	UID                    string    `json:"uid,omitempty"`
+	TokenId                string    `json:"jti,omitempty"`
+	RefreshTokenId         string    `json:"refresh_jti,omitempty"`
+	PreviousRefreshTokenId string    `json:"previous_refresh_jti,omitempty"`
+	Reason                 string    `json:"reason,omitempty"`
+	Method                 string    `json:"method,omitempty"`
+	Path                   string    `json:"path,omitempty"`
+	RemoteAddr             string    `json:"remote_addr,omitempty"`
+	UserAgent              string    `json:"user_agent,omitempty"`
+	PreviousMAC            string    `json:"prev_mac"`
+	MAC                    string    `json:"mac"`
+}
+
+// AuditCheckpoint : the last record of the audit log. Records removed from the end of the
+// log leave a valid chain, so a checkpoint kept elsewhere is what they're told by (see
+// VerifyAuditLog).
+type AuditCheckpoint struct {
+	Seq uint64
+	MAC string
+}
+
+// AuditLog : an append-only log of the events of the tokens, as json lines, in a HMAC chain.
+// When the file reaches its MaxSize, it's renamed to path.000001, path.000002, ... and the
+// chain goes on in a new file.
+type AuditLog struct {
+	// guards the fields below
+	mu       sync.Mutex
+	path     string
+	options  AuditLogOptions
+	file     *os.File
+	size     int64
+	rotation int
+	last     AuditCheckpoint
+}
+
+// NewAuditLog : the audit log at path, which is created if it doesn't exist, and appended to
+// if it does. A torn record at the end of the log is cut, and an AuditLogRecovered record is
+// written in its place. Record it with Auth.AddEventHook.
+func NewAuditLog(path string, o AuditLogOptions) (*AuditLog, error) {
+	if len(o.Key) < minAuditLogKeySize {
+		return nil, errors.New("audit log requires a key of at least 32 bytes")
+	}
+	if o.MaxSize <= 0 {
+		o.MaxSize = defaultAuditLogMaxSize
+	}
+
+	files, err := auditLogFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &AuditLog{path: path, options: o, rotation: len(files) - 1}
+	var torn int64
+	// the chain goes on from the last record, which may be in a rotated file
+	for i := len(files) - 1; i >= 0 && l.last.Seq == 0; i-- {
+		last, end, err := lastAuditRecord(files[i], o.Key)
+		// only the current file is written to, so only it can be torn by a crash
+		if errors.Is(err, ErrAuditLogTorn) && files[i] == path {
+			torn, err = truncateAuditLog(path, end)
+		}
+		if err != nil {
+			return nil, err
+		}
+		l.last = last
+	}
+
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+
+	if torn > 0 {
+		recovered := AuditRecord{
+			Time:   time.Now().UTC(),
+			Event:  AuditLogRecovered,
+			Reason: fmt.Sprintf("cut a torn record of %d bytes", torn),
+		}
+		if err := l.append(recovered); err != nil {
+			l.file.Close()
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+// Record : append the event to the log; an EventHook
+func (l *AuditLog) Record(ctx context.Context, event Event) error {
+	record := AuditRecord{
+		Time:                   event.Time.UTC(),
+		Event:                  event.Type,
+		UID:                    event.Claims.UID,
+		TokenId:                event.Claims.ID,
+		RefreshTokenId:         event.RefreshTokenId,
+		PreviousRefreshTokenId: event.PreviousRefreshTokenId,
+		Reason:                 event.Reason,
+		Method:                 event.Request.Method,
+		Path:                   event.Request.Path,
+		RemoteAddr:             event.Request.RemoteAddr,
+		UserAgent:              event.Request.UserAgent,
+	}
+
+	if err := l.append(record); err != nil {
+		if l.options.FailClosed {
+			return fmt.Errorf("cannot record %s in the audit log: %v: %w", event.Type, err, ErrHookAborted)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Checkpoint : the last record of the log
+func (l *AuditLog) Checkpoint() AuditCheckpoint {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.last
+}
+
+// Close : close the file of the log
+func (l *AuditLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.file.Close()
+}
+
+// append : chain the record to the last one, and write it
+func (l *AuditLog) append(record AuditRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	record.Seq = l.last.Seq + 1
+	record.PreviousMAC = l.last.MAC
+	line, mac, err := encodeAuditRecord(record, l.options.Key)
+	if err != nil {
+		return err
+	}
+
+	if l.size > 0 && l.size+int64(len(line)) > l.options.MaxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return err
+	}
+	// the record must survive a crash once the event is let through
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+
+	l.last = AuditCheckpoint{Seq: record.Seq, MAC: mac}
+	return nil
+}
+
+// open : open the current file of the log for appending
+func (l *AuditLog) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// rotate : move the current file aside and start a new one
+func (l *AuditLog) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(l.path, rotatedAuditLogPath(l.path, l.rotation+1)); err != nil {
+		return err
+	}
+	l.rotation++
+
+	return l.open()
+}
+
+// encodeAuditRecord : the line of the record, and its mac. The mac is of the line without
+// it, so the exact bytes that were written are checked.
+func encodeAuditRecord(record AuditRecord, key []byte) ([]byte, string, error) {
+	record.MAC = ""
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return nil, "", err
+	}
+
+	unsigned := bytes.TrimSuffix(encoded, []byte(macField+`"}`))
+	mac := auditRecordMAC(key, unsigned)
+
+	line := append(unsigned, []byte(macField+mac+"\"}\n")...)
+	return line, mac, nil
+}
+
+// auditRecordMAC : the mac of a line, given without its mac field
+func auditRecordMAC(key []byte, unsigned []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(unsigned)
+	mac.Write([]byte("}"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// rotatedAuditLogPath : where the nth rotated file of the log is kept
+func rotatedAuditLogPath(path string, n int) string {
+	return fmt.Sprintf("%s.%06d", path, n)
+}
+
+// auditLogFiles : the files of the log, oldest first; the current one is last
+func auditLogFiles(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	var rotations []int
+	for _, match := range matches {
+		n, err := strconv.Atoi(strings.TrimPrefix(match, path+"."))
+		if err == nil && match == rotatedAuditLogPath(path, n) {
+			rotations = append(rotations, n)
+		}
+	}
+	sort.Ints(rotations)
+
+	files := make([]string, 0, len(rotations)+1)
+	for i, n := range rotations {
+		// a missing rotated file means records have been removed
+		if n != i+1 {
+			return nil, fmt.Errorf("%s: %w", rotatedAuditLogPath(path, i+1), ErrAuditLogTampered)
+		}
+		files = append(files, rotatedAuditLogPath(path, n))
+	}
+
+	return append(files, path), nil
+}
+
+// lastAuditRecord : the checkpoint of the last record of the file, and where the record ends.
+// A missing or empty file has none.
+func lastAuditRecord(path string, key []byte) (AuditCheckpoint, int64, error) {
+	var last AuditCheckpoint
+	end, err := readAuditLogFile(path, key, func(record AuditRecord, valid bool) error {
+		if !valid {
+			return fmt.Errorf("%s: record %d: mac mismatch: %w", path, record.Seq, ErrAuditLogTampered)
+		}
+		last = AuditCheckpoint{Seq: record.Seq, MAC: record.MAC}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return AuditCheckpoint{}, 0, nil
+	}
+
+	return last, end, err
+}
+
+// truncateAuditLog : cut the file at end, returning how many bytes were cut
+func truncateAuditLog(path string, end int64) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Truncate(path, end); err != nil {
+		return 0, err
+	}
+
+	return info.Size() - end, nil
+}
+
+// readAuditLogFile : call fn with every record of the file, and whether its mac matches it.
+// It returns where the last whole line ends, and ErrAuditLogTorn when the file ends in the
+// middle of a line; records are written whole, newline included.
+func readAuditLogFile(path string, key []byte, fn func(record AuditRecord, valid bool) error) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var end int64
+	for line := 1; ; line++ {
+		text, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(text) > 0 {
+				return end, fmt.Errorf("%s:%d: %w", path, line, ErrAuditLogTorn)
+			}
+			return end, nil
+		}
+		if err != nil {
+			return end, err
+		}
+
+		var record AuditRecord
+		if err := json.Unmarshal(text, &record); err != nil {
+			return end, fmt.Errorf("%s:%d: %v: %w", path, line, err, ErrAuditLogTampered)
+		}
+
+		i := bytes.LastIndex(text, []byte(macField))
+		valid := i >= 0 && hmac.Equal([]byte(auditRecordMAC(key, text[:i])), []byte(record.MAC))
+		if err := fn(record, valid); err != nil {
+			return end, err
+		}
+		end += int64(len(text))
+	}
+}
+
+// VerifyAuditLog : check the HMAC chain of the audit log at path, rotated files included, and
+// return its last record. Edited, reordered or removed records, and removed rotated files, are
+// reported as ErrAuditLogTampered, and a record torn by a crash as ErrAuditLogTorn. Records
+// removed from the end of the log leave a valid chain; they're reported when the log ends
+// before the checkpoint, one saved from AuditLog.Checkpoint and kept away from the log. The
+// zero checkpoint checks the chain only.
+func VerifyAuditLog(path string, key []byte, checkpoint AuditCheckpoint) (AuditCheckpoint, error) {
+	files, err := auditLogFiles(path)
+	if err != nil {
+		return AuditCheckpoint{}, err
+	}
+
+	var last AuditCheckpoint
+	var torn error
+	for _, file := range files {
+		_, err := readAuditLogFile(file, key, func(record AuditRecord, valid bool) error {
+			if !valid {
+				return fmt.Errorf("%s: record %d: mac mismatch: %w", file, record.Seq, ErrAuditLogTampered)
+			}
+			if record.Seq != last.Seq+1 || record.PreviousMAC != last.MAC {
+				return fmt.Errorf("%s: record %d: doesn't follow record %d: %w", file, record.Seq, last.Seq, ErrAuditLogTampered)
+			}
+			if record.Seq == checkpoint.Seq && record.MAC != checkpoint.MAC {
+				return fmt.Errorf("%s: record %d: doesn't match the checkpoint: %w", file, record.Seq, ErrAuditLogTampered)
+			}
+
+			last = AuditCheckpoint{Seq: record.Seq, MAC: record.MAC}
+			return nil
+		})
+		switch {
+		// the current file may not have been created yet
+		case os.IsNotExist(err) && file == path:
+		// rotated files were whole when they were moved aside
+		case errors.Is(err, ErrAuditLogTorn) && file == path:
+			torn = err
+		case errors.Is(err, ErrAuditLogTorn):
+			return last, fmt.Errorf("%s: rotated file was cut: %w", file, ErrAuditLogTampered)
+		case err != nil:
+			return last, err
+		}
+	}
+
+	// a torn record doesn't hide records removed before it
+	if last.Seq < checkpoint.Seq {
+		return last, fmt.Errorf("%s: ends at record %d, before the checkpoint at record %d: %w", path, last.Seq, checkpoint.Seq, ErrAuditLogTampered)
+	}
+
+	return last, torn
+}
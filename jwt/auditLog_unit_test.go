@@ -0,0 +1,259 @@
+package jwt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testAuditLogKey = bytes.Repeat([]byte("a"), 32)
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	auditLog, err := NewAuditLog(path, AuditLogOptions{Key: testAuditLogKey})
+	if err != nil {
+		t.Fatalf("Unable to open audit log; Err: %v", err)
+	}
+
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString: "HS256",
+		HMACKey:             []byte("test key"),
+		BearerTokens:        true,
+		UpdateTokenClaims:   func(claims *ClaimsType) ClaimsType { return *claims },
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+	a.AddEventHook(auditLog.Record)
+
+	w := httptest.NewRecorder()
+	if err := a.IssueNewTokens(w, &ClaimsType{UID: "user id"}); err != nil {
+		t.Fatalf("Unable to issue tokens; Err: %v", err)
+	}
+
+	req, reqErr := http.NewRequest("GET", "http://localhost:8080/restricted", nil)
+	if reqErr != nil {
+		t.Fatalf("Error building request for testing; err: %v", reqErr)
+	}
+	req.Header.Set(a.options.AuthTokenName, w.Header().Get(a.options.AuthTokenName))
+	req.Header.Set(a.options.RefreshTokenName, w.Header().Get(a.options.RefreshTokenName))
+	req.Header.Set(a.options.CSRFTokenName, "wrong csrf string")
+	if _, err := a.Process(httptest.NewRecorder(), req); err == nil {
+		t.Fatalf("Expected the request to be refused")
+	}
+
+	req.Header.Set(a.options.CSRFTokenName, w.Header().Get(a.options.CSRFTokenName))
+	if err := a.NullifyTokens(httptest.NewRecorder(), req); err != nil {
+		t.Fatalf("Unable to nullify tokens; Err: %v", err)
+	}
+
+	checkpoint, err := VerifyAuditLog(path, testAuditLogKey, auditLog.Checkpoint())
+	if err != nil {
+		t.Fatalf("Expected a valid audit log; Err: %v", err)
+	}
+	if checkpoint != auditLog.Checkpoint() || checkpoint.Seq != 3 {
+		t.Errorf("Expected the checkpoint of the 3rd record; Received: %+v, %+v", checkpoint, auditLog.Checkpoint())
+	}
+
+	var records []AuditRecord
+	_, err = readAuditLogFile(path, testAuditLogKey, func(record AuditRecord, valid bool) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unable to read audit log; Err: %v", err)
+	}
+	expectedEvents := []EventType{TokensIssued, AuthRejected, TokensNullified}
+	for i, record := range records {
+		if record.Event != expectedEvents[i] || record.UID != "user id" {
+			t.Errorf("Expected a %s record of the user; Received: %+v", expectedEvents[i], record)
+		}
+	}
+	if records[1].Reason != "csrf_mismatch" || records[1].Path != "/restricted" {
+		t.Errorf("Expected the reason and the request of the refusal; Received: %+v", records[1])
+	}
+
+	// the chain goes on after the log is reopened
+	if err := auditLog.Close(); err != nil {
+		t.Fatalf("Unable to close audit log; Err: %v", err)
+	}
+	auditLog, err = NewAuditLog(path, AuditLogOptions{Key: testAuditLogKey})
+	if err != nil {
+		t.Fatalf("Unable to reopen audit log; Err: %v", err)
+	}
+	defer auditLog.Close()
+	if err := auditLog.Record(context.Background(), Event{Type: TokensIssued}); err != nil {
+		t.Fatalf("Unable to record event; Err: %v", err)
+	}
+	if checkpoint, err := VerifyAuditLog(path, testAuditLogKey, checkpoint); err != nil || checkpoint.Seq != 4 {
+		t.Errorf("Expected a valid audit log of 4 records; Received: %+v, Err: %v", checkpoint, err)
+	}
+}
+
+func TestAuditLogTampering(t *testing.T) {
+	dir := t.TempDir()
+	writeLog := func(path string, key []byte) AuditCheckpoint {
+		auditLog, err := NewAuditLog(path, AuditLogOptions{Key: key})
+		if err != nil {
+			t.Fatalf("Unable to open audit log; Err: %v", err)
+		}
+		defer auditLog.Close()
+		for _, uid := range []string{"first", "second", "third"} {
+			if err := auditLog.Record(context.Background(), Event{Type: TokensIssued, Claims: ClaimsType{UID: uid}}); err != nil {
+				t.Fatalf("Unable to record event; Err: %v", err)
+			}
+		}
+		return auditLog.Checkpoint()
+	}
+
+	path := filepath.Join(dir, "audit.log")
+	checkpoint := writeLog(path, testAuditLogKey)
+	original, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unable to read audit log; Err: %v", err)
+	}
+	lines := bytes.SplitAfter(original, []byte("\n"))
+
+	// the same records, chained by someone without the key
+	forgedPath := filepath.Join(dir, "forged.log")
+	writeLog(forgedPath, bytes.Repeat([]byte("b"), 32))
+	forged, err := os.ReadFile(forgedPath)
+	if err != nil {
+		t.Fatalf("Unable to read audit log; Err: %v", err)
+	}
+
+	var tests = []struct {
+		name             string
+		content          []byte
+		checkpoint       AuditCheckpoint
+		expectedTampered bool
+	}{
+		{"untouched", original, checkpoint, false},
+		{"edited record", bytes.Replace(original, []byte(`"uid":"second"`), []byte(`"uid":"mallory"`), 1), checkpoint, true},
+		{"removed record", bytes.Join([][]byte{lines[0], lines[2]}, nil), checkpoint, true},
+		{"reordered records", bytes.Join([][]byte{lines[1], lines[0], lines[2]}, nil), checkpoint, true},
+		{"truncated record", original[:len(original)-10], checkpoint, true},
+		{"removed first record", bytes.Join([][]byte{lines[1], lines[2]}, nil), checkpoint, true},
+		{"removed last record", bytes.Join([][]byte{lines[0], lines[1]}, nil), checkpoint, true},
+		{"rebuilt chain", forged, checkpoint, true},
+		{"rebuilt chain without checkpoint", forged, AuditCheckpoint{}, true},
+		// without a checkpoint, only the chain is checked
+		{"removed last record without checkpoint", bytes.Join([][]byte{lines[0], lines[1]}, nil), AuditCheckpoint{}, false},
+	}
+
+	for _, test := range tests {
+		if err := os.WriteFile(path, test.content, 0600); err != nil {
+			t.Fatalf("Unable to write audit log; Err: %v", err)
+		}
+
+		last, err := VerifyAuditLog(path, testAuditLogKey, test.checkpoint)
+		if errors.Is(err, ErrAuditLogTampered) != test.expectedTampered || (err != nil && !test.expectedTampered) {
+			t.Errorf("[%s] Expected tampered to be %v; Err: %v", test.name, test.expectedTampered, err)
+		}
+		if err == nil && (last == checkpoint) != bytes.Equal(test.content, original) {
+			t.Errorf("[%s] Unexpected checkpoint; Received: %+v, Expected: %+v", test.name, last, checkpoint)
+		}
+	}
+
+	if _, err := NewAuditLog(path, AuditLogOptions{Key: []byte("short key")}); err == nil {
+		t.Error("Expected an error opening an audit log with a short key")
+	}
+}
+
+func TestAuditLogTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	auditLog, err := NewAuditLog(path, AuditLogOptions{Key: testAuditLogKey})
+	if err != nil {
+		t.Fatalf("Unable to open audit log; Err: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := auditLog.Record(context.Background(), Event{Type: TokensIssued}); err != nil {
+			t.Fatalf("Unable to record event; Err: %v", err)
+		}
+	}
+	checkpoint := auditLog.Checkpoint()
+	auditLog.Close()
+
+	// a crash in the middle of writing the 3rd record
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("Unable to open audit log file; Err: %v", err)
+	}
+	file.WriteString(`{"seq":3,"time":"2024-01-01T00:00:00Z","ev`)
+	file.Close()
+
+	last, err := VerifyAuditLog(path, testAuditLogKey, checkpoint)
+	if !errors.Is(err, ErrAuditLogTorn) || errors.Is(err, ErrAuditLogTampered) || last != checkpoint {
+		t.Errorf("Expected a torn record to be reported; Received: %+v, Err: %v", last, err)
+	}
+
+	// the torn record is cut when the log is reopened, and the cut is recorded
+	auditLog, err = NewAuditLog(path, AuditLogOptions{Key: testAuditLogKey})
+	if err != nil {
+		t.Fatalf("Unable to reopen audit log; Err: %v", err)
+	}
+	defer auditLog.Close()
+	if auditLog.Checkpoint().Seq != 3 {
+		t.Errorf("Expected the recovery to be recorded; Received: %+v", auditLog.Checkpoint())
+	}
+
+	var recovered AuditRecord
+	_, err = readAuditLogFile(path, testAuditLogKey, func(record AuditRecord, valid bool) error {
+		recovered = record
+		return nil
+	})
+	if err != nil || recovered.Event != AuditLogRecovered || recovered.Reason != "cut a torn record of 42 bytes" {
+		t.Errorf("Expected an %s record; Received: %+v, Err: %v", AuditLogRecovered, recovered, err)
+	}
+	if _, err := VerifyAuditLog(path, testAuditLogKey, checkpoint); err != nil {
+		t.Errorf("Expected a valid audit log; Err: %v", err)
+	}
+}
+
+func TestAuditLogRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	// every record is rotated into a file of its own
+	auditLog, err := NewAuditLog(path, AuditLogOptions{Key: testAuditLogKey, MaxSize: 1})
+	if err != nil {
+		t.Fatalf("Unable to open audit log; Err: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := auditLog.Record(context.Background(), Event{Type: TokensIssued}); err != nil {
+			t.Fatalf("Unable to record event; Err: %v", err)
+		}
+	}
+	auditLog.Close()
+
+	for _, file := range []string{path + ".000001", path + ".000002", path} {
+		if _, err := os.Stat(file); err != nil {
+			t.Errorf("Expected a file of the log; Err: %v", err)
+		}
+	}
+
+	// the chain goes on in the last file after the log is reopened
+	auditLog, err = NewAuditLog(path, AuditLogOptions{Key: testAuditLogKey, MaxSize: 1})
+	if err != nil {
+		t.Fatalf("Unable to reopen audit log; Err: %v", err)
+	}
+	if err := auditLog.Record(context.Background(), Event{Type: TokensIssued}); err != nil {
+		t.Fatalf("Unable to record event; Err: %v", err)
+	}
+	auditLog.Close()
+
+	if checkpoint, err := VerifyAuditLog(path, testAuditLogKey, auditLog.Checkpoint()); err != nil || checkpoint != auditLog.Checkpoint() || checkpoint.Seq != 4 {
+		t.Errorf("Expected a valid audit log of 4 records; Received: %+v, Err: %v", checkpoint, err)
+	}
+
+	if err := os.Remove(path + ".000002"); err != nil {
+		t.Fatalf("Unable to remove rotated file; Err: %v", err)
+	}
+	if _, err := VerifyAuditLog(path, testAuditLogKey, AuditCheckpoint{}); !errors.Is(err, ErrAuditLogTampered) {
+		t.Errorf("Expected a removed rotated file to be detected; Err: %v", err)
+	}
+}
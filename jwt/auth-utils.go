@@ -1,16 +1,18 @@
 package jwt
 
 import (
-	"errors"
-	"log"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel/codes"
 )
 
 // return is (authTokenString, refreshTokenString, err)
-func (a *Auth) extractTokenStringsFromReq(r *http.Request) (string, string, *jwtError) {
+func (a *Auth) extractTokenStringsFromReq(r *http.Request) (string, string, *Error) {
 	// read cookies
 	if a.options.BearerTokens {
 		// tokens are not in cookies
@@ -25,17 +27,16 @@ func (a *Auth) extractTokenStringsFromReq(r *http.Request) (string, string, *jwt
 
 	AuthCookie, authErr := r.Cookie(a.options.AuthTokenName)
 	if authErr == http.ErrNoCookie {
-		a.myLog("Unauthorized attempt! No auth cookie")
-		return "", "", newJwtError(errors.New("no auth cookie"), 401)
+		a.log().Debug("request has no auth cookie", "path", r.URL.Path)
+		return "", "", newReasonError(ErrNoAuthToken, nil, 401)
 	} else if authErr != nil {
-		// a.myLog(authErr)
-		return "", "", newJwtError(errors.New("internal Server Error"), 500)
+		return "", "", newJwtError(fmt.Errorf("internal Server Error: %w", authErr), 500)
 	}
 
 	RefreshCookie, refreshErr := r.Cookie(a.options.RefreshTokenName)
 	if refreshErr != nil && refreshErr != http.ErrNoCookie {
-		a.myLog(refreshErr)
-		return "", "", newJwtError(errors.New("internal Server Error"), 500)
+		a.log().Error("refresh cookie cannot be read", "error", refreshErr.Error())
+		return "", "", newJwtError(fmt.Errorf("internal Server Error: %w", refreshErr), 500)
 	}
 
 	if AuthCookie != nil {
@@ -48,7 +49,7 @@ func (a *Auth) extractTokenStringsFromReq(r *http.Request) (string, string, *jwt
 	return authCookieValue, refreshCookieValue, nil
 }
 
-func (a *Auth) extractCsrfStringFromReq(r *http.Request) (string, *jwtError) {
+func (a *Auth) extractCsrfStringFromReq(r *http.Request) (string, *Error) {
 	// csrfCookie, _ := r.Cookie(a.options.CSRFTokenName)
 	// if csrfCookie != nil {
 	// 	return csrfCookie.Value, nil
@@ -69,30 +70,35 @@ func (a *Auth) extractCsrfStringFromReq(r *http.Request) (string, *jwtError) {
 	csrfString = strings.Replace(auth, "Bearer", "", 1)
 	csrfString = strings.Replace(csrfString, " ", "", -1)
 	if csrfString == "" {
-		return csrfString, newJwtError(errors.New("no CSRF string"), 401)
+		return csrfString, newReasonError(ErrNoCSRFToken, nil, 401)
 	}
 
 	return csrfString, nil
 }
 
-func (a *Auth) setCredentialsOnResponseWriter(w http.ResponseWriter, c *credentials) *jwtError {
+func (a *Auth) setCredentialsOnResponseWriter(w http.ResponseWriter, c *credentials) *Error {
 	var (
 		refreshTokenString string
 		refreshTokenClaims *ClaimsType
 	)
 
-	authTokenString, err := c.AuthToken.Token.SignedString(a.signKey)
+	_, span := a.tracer().Start(c.context(), "jwt.sign")
+	authTokenString, err := a.encodeToken(c.AuthToken.Token)
 	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
 		return newJwtError(err, 500)
 	}
+	c.AuthTokenString = authTokenString
 	if c.RefreshToken != nil && c.RefreshToken.Token != nil {
-		a.myLog(c.RefreshToken)
-		a.myLog(c.RefreshToken.Token)
-		refreshTokenString, err = c.RefreshToken.Token.SignedString(a.signKey)
+		refreshTokenString, err = a.encodeRefreshToken(c.RefreshToken.Token)
 		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.End()
 			return newJwtError(err, 500)
 		}
 	}
+	span.End()
 
 	if a.options.BearerTokens {
 		// tokens are not in cookies
@@ -142,14 +148,14 @@ func (a *Auth) setCredentialsOnResponseWriter(w http.ResponseWriter, c *credenti
 
 	authTokenClaims, ok := c.AuthToken.Token.Claims.(*ClaimsType)
 	if !ok {
-		a.myLog("Cannot read auth token claims")
-		return newJwtError(errors.New("cannot read token claims"), 500)
+		a.log().Error("auth token claims cannot be read", "reason", reasonOf(ErrInvalidClaims))
+		return newReasonError(ErrInvalidClaims, nil, 500)
 	}
 	if c.RefreshToken != nil && c.RefreshToken.Token != nil {
 		refreshTokenClaims, ok = c.RefreshToken.Token.Claims.(*ClaimsType)
 		if !ok {
-			a.myLog("Cannot read refresh token claims")
-			return newJwtError(errors.New("cannot read token claims"), 500)
+			a.log().Error("refresh token claims cannot be read", "reason", reasonOf(ErrInvalidClaims))
+			return newReasonError(ErrInvalidClaims, nil, 500)
 		}
 	}
 
@@ -164,13 +170,61 @@ func (a *Auth) setCredentialsOnResponseWriter(w http.ResponseWriter, c *credenti
 	return nil
 }
 
-func (a *Auth) buildCredentialsFromRequest(r *http.Request, c *credentials) *jwtError {
+// encodeToken : the token as it's handed to the client, in the configured token format
+func (a *Auth) encodeToken(token *jwtGo.Token) (string, error) {
+	entry, err := a.keys.signingEntry()
+	if err != nil {
+		return "", err
+	}
+
+	start := time.Now()
+	tokenString, err := a.codec.encode(token, entry)
+	a.metrics().TokenSigned(time.Since(start))
+
+	return tokenString, err
+}
+
+// signToken : sign as a jwt with the active key from the keyring, stamping its kid into the header
+func (a *Auth) signToken(token *jwtGo.Token) (string, error) {
+	entry, err := a.keys.signingEntry()
+	if err != nil {
+		return "", err
+	}
+
+	return signJWT(token, entry, a.options.EmbedCertificateChain)
+}
+
+// keyResolver : where the keys used to verify tokens come from
+func (a *Auth) keyResolver() keyResolver {
+	var resolver keyResolver = a.keys
+	if a.remoteKeys != nil {
+		resolver = a.remoteKeys
+	}
+
+	// verify only servers can trust any key certified by one of their roots
+	if a.options.VerifyOnlyServer && a.options.CertificateRoots != nil {
+		resolver = &x5cKeyResolver{
+			roots:               a.options.CertificateRoots,
+			keyUsages:           a.options.CertificateKeyUsages,
+			signingMethodString: a.options.SigningMethodString,
+			next:                resolver,
+		}
+	}
+
+	return resolver
+}
+
+func (a *Auth) buildCredentialsFromRequest(r *http.Request, c *credentials) *Error {
+	c.ctx = r.Context()
+	_, span := a.tracer().Start(c.ctx, "jwt.extract")
 	authTokenString, refreshTokenString, err := a.extractTokenStringsFromReq(r)
 	if err != nil {
+		endSpan(span, err)
 		return newJwtError(err, 500)
 	}
 
 	csrfString, err := a.extractCsrfStringFromReq(r)
+	endSpan(span, err)
 	if err != nil {
 		return newJwtError(err, 500)
 	}
@@ -183,12 +237,6 @@ func (a *Auth) buildCredentialsFromRequest(r *http.Request, c *credentials) *jwt
 	return nil
 }
 
-func (a *Auth) myLog(stoofs interface{}) {
-	if a.options.Debug {
-		log.Println(stoofs)
-	}
-}
-
 func setHeader(w http.ResponseWriter, header string, value string) {
 	w.Header().Set(header, value)
 }
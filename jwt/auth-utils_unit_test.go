@@ -287,11 +287,11 @@ func TestBuildCredentialsFromRequest(t *testing.T) {
 		t.Errorf("Cound not build credentials for testing; err: %v", err)
 	}
 
-	authTokenString, authStringErr := c.AuthToken.Token.SignedString(a.signKey)
+	authTokenString, authStringErr := a.signToken(c.AuthToken.Token)
 	if authStringErr != nil {
 		t.Errorf("Cound not sign authTokenString; err: %v", authStringErr)
 	}
-	refreshTokenString, refreshStringErr := c.RefreshToken.Token.SignedString(a.signKey)
+	refreshTokenString, refreshStringErr := a.signToken(c.RefreshToken.Token)
 	if refreshStringErr != nil {
 		t.Errorf("Cound not sign refreshTokenString; err: %v", refreshStringErr)
 	}
@@ -334,11 +334,11 @@ func TestBuildCredentialsFromRequest(t *testing.T) {
 		t.Errorf("Csrf strings don't match; expected: %s; received: %s", c.CsrfString, c2.CsrfString)
 	}
 
-	authTokenString2, authStringErr := c2.AuthToken.Token.SignedString(a.signKey)
+	authTokenString2, authStringErr := a.signToken(c2.AuthToken.Token)
 	if authStringErr != nil {
 		t.Errorf("Cound not sign authTokenString; err: %v", authStringErr)
 	}
-	refreshTokenString2, refreshStringErr := c2.RefreshToken.Token.SignedString(a.signKey)
+	refreshTokenString2, refreshStringErr := a.signToken(c2.RefreshToken.Token)
 	if refreshStringErr != nil {
 		t.Errorf("Cound not sign refreshTokenString; err: %v", refreshStringErr)
 	}
@@ -1,22 +1,31 @@
 package jwt
 
 import (
+	"context"
+	"crypto"
+	"crypto/x509"
 	"errors"
-	"io/ioutil"
+	"io/fs"
+	"log/slog"
 	"net/http"
-	"reflect"
 	"strconv"
 	"time"
 
 	jwtGo "github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Auth is a middleware that provides jwt based authentication.
 type Auth struct {
-	signKey   interface{}
-	verifyKey interface{}
+	keys       *keyring
+	remoteKeys *remoteKeySet
+	reloader   *keyReloader
+	rotator    *keyRotator
+	codec      tokenCodec
 
 	options Options
+	logger  *slog.Logger
 
 	// Handlers for when an error occurs
 	errorHandler        http.Handler
@@ -24,25 +33,68 @@ type Auth struct {
 
 	// funcs for checking and revoking refresh tokens
 	revokeRefreshToken TokenRevoker
+	rotateTokenId      TokenIdRotator
 	checkTokenId       TokenIdChecker
+
+	// called on the lifecycle events of the tokens
+	eventHooks []EventHook
 }
 
 // Options is a struct for specifying configuration options
 type Options struct {
 	SigningMethodString   string
+	AcceptSigningMethods  []string
+	TokenFormat           string
+	KeyID                 string
 	PrivateKeyLocation    string
 	PublicKeyLocation     string
+	PrivateKeyPEM         []byte
+	PublicKeyPEM          []byte
+	PrivateKeyPassword    []byte
+	Signer                crypto.Signer
+	PrivateKey            crypto.PrivateKey
+	PublicKey             crypto.PublicKey
+	KeyFS                 fs.FS
+	CertificateRoots      *x509.CertPool
+	CertificateKeyUsages  []x509.ExtKeyUsage
+	EmbedCertificateChain bool
+	TokenEncryption       string
+	TokenEncryptionKey    []byte
+	TokenDecryptionKey    crypto.Decrypter
+	WatchKeyFiles         bool
+	KeyWatchInterval      time.Duration
+	KeyRotationInterval   time.Duration
+	KeyPrePublishTime     time.Duration
+	KeyStore              KeyStore
 	HMACKey               []byte
 	VerifyOnlyServer      bool
 	BearerTokens          bool
 	RefreshTokenValidTime time.Duration
 	AuthTokenValidTime    time.Duration
+	Issuer                string
+	Audience              string
+	Leeway                time.Duration
+	FlattenCustomClaims   bool
 	AuthTokenName         string
 	RefreshTokenName      string
 	CSRFTokenName         string
+	JWKSMaxAge            time.Duration
+	ProblemDetails        bool
+	RefreshTokenStore     RefreshTokenStore
 	UpdateTokenClaims     TokenClaimsGenerator
-	Debug                 bool
+	Logger                *slog.Logger
+	Metrics               Metrics
+	TracerProvider        trace.TracerProvider
+	LogSecrets            bool
+	Debug                 bool // Deprecated: set a Logger with a debug level instead
 	IsDevEnv              bool
+
+	// verify only servers can fetch their verify keys from the jwks of the issuing server
+	// instead of reading them from PublicKeyLocation
+	JWKSURL                string
+	JWKSCacheTTL           time.Duration
+	JWKSMinRefreshInterval time.Duration
+	JWKSHTTPClient         *http.Client
 }
 
 const (
@@ -53,6 +105,7 @@ const (
 	defaultCSRFTokenName          = "X-CSRF-Token"
 	defaultCookieAuthTokenName    = "AuthToken"
 	defaultCookieRefreshTokenName = "RefreshToken"
+	defaultJWKSMaxAge             = 15 * time.Minute
 )
 
 // ClaimsType : holds the claims encoded in the jwt
@@ -61,8 +114,15 @@ type ClaimsType struct {
 	// https://tools.ietf.org/html/rfc7519
 	UID  string `json:"uid,omitempty"`
 	Csrf string `json:"csrf,omitempty"`
+	// TokenUse : "access" or "refresh"; set when the tokens are issued, so one can't be used as the other
+	TokenUse string `json:"token_use,omitempty"`
 	jwtGo.RegisteredClaims
 	CustomClaims map[string]interface{}
+
+	// encode the custom claims at the top level of the payload (see Options.FlattenCustomClaims)
+	flattenCustomClaims bool
+	// the json the custom claims were read or written from (see customClaimsEncoding)
+	customClaimsJSON []byte
 }
 
 // Claims generator for issuing new tokens on refresh
@@ -75,6 +135,11 @@ func defaultTokenRevoker(tokenId string) error {
 // TokenRevoker : a type to revoke tokens
 type TokenRevoker func(tokenId string) error
 
+// TokenIdRotator : called with the jti of every refresh token that's issued, and the jti of the
+// refresh token it replaces; empty when the tokens are issued by IssueNewTokens. A whitelist of
+// refresh tokens adds the new jti and removes the previous one. An error fails the request.
+type TokenIdRotator func(previousTokenId string, tokenId string) error
+
 func defaultCheckTokenId(tokenClaims *ClaimsType) bool {
 	// return true if the token id is valid (has not been revoked). False for otherwise
 	return true
@@ -95,7 +160,7 @@ func defaultErrorHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func defaultUnauthorizedHandler(w http.ResponseWriter, r *http.Request) {
-	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	WWWAuthenticateHandler(w, r)
 }
 
 // New constructs a new Auth instance with supplied options.
@@ -131,25 +196,170 @@ func New(auth *Auth, o Options) error {
 		o.CSRFTokenName = defaultCSRFTokenName
 	}
 
-	// create the sign and verify keys
-	signKey, verifyKey, err := o.buildSignAndVerifyKeys()
+	if o.JWKSMaxAge <= 0 {
+		o.JWKSMaxAge = defaultJWKSMaxAge
+	}
+
+	auth.logger = newLogger(&o)
+
+	// stop watching the key files of a previous configuration
+	if auth.reloader != nil {
+		auth.reloader.close()
+	}
+	auth.reloader = newKeyReloader(auth.logger)
+	if o.WatchKeyFiles {
+		if o.JWKSURL != "" {
+			return errors.New("keys fetched from a jwks url cannot be watched")
+		}
+		if len(o.keyFileLocations()) == 0 {
+			return errors.New("watching key files requires a PrivateKeyLocation or PublicKeyLocation")
+		}
+		if o.KeyWatchInterval <= 0 {
+			o.KeyWatchInterval = defaultKeyWatchInterval
+		}
+	}
+
+	if o.KeyRotationInterval > 0 {
+		// generated keys replace the configured ones
+		if o.VerifyOnlyServer || o.JWKSURL != "" || o.WatchKeyFiles {
+			return errors.New("key rotation can only be used by a server that signs its own tokens")
+		}
+		if o.hasKeySource() {
+			return errors.New("keys are generated when rotating keys, no key can be configured")
+		}
+		if o.KeyPrePublishTime <= 0 {
+			o.KeyPrePublishTime = defaultKeyPrePublishTime
+			if o.KeyRotationInterval/2 < o.KeyPrePublishTime {
+				o.KeyPrePublishTime = o.KeyRotationInterval / 2
+			}
+		}
+		if o.KeyPrePublishTime >= o.KeyRotationInterval {
+			return errors.New("KeyPrePublishTime must be shorter than KeyRotationInterval")
+		}
+	} else if o.KeyStore != nil {
+		return errors.New("a KeyStore requires a KeyRotationInterval")
+	}
+
+	if o.Leeway < 0 {
+		return errors.New("leeway cannot be negative")
+	}
+
+	codec, err := o.buildTokenCodec()
 	if err != nil {
 		return err
 	}
+	auth.codec = codec
+
+	if (o.CertificateRoots != nil || o.EmbedCertificateChain) && !isPublicKeySigningMethod(o.SigningMethodString) {
+		return errors.New("certificates require a public key signing method")
+	}
+	if o.EmbedCertificateChain && o.CertificateRoots == nil {
+		return errors.New("EmbedCertificateChain requires CertificateRoots")
+	}
+	if len(o.CertificateKeyUsages) == 0 {
+		o.CertificateKeyUsages = defaultCertificateKeyUsages
+	}
+	for _, usage := range o.CertificateKeyUsages {
+		if usage == x509.ExtKeyUsageAny {
+			return errors.New("CertificateKeyUsages must name the usages of the certificates, not ExtKeyUsageAny")
+		}
+	}
+
+	// other signing methods are only accepted when they're explicitly allowed, and can
+	// only be verified with the same keys
+	for _, method := range o.AcceptSigningMethods {
+		if signingMethodKeyType(method) == "" || signingMethodKeyType(method) != signingMethodKeyType(o.SigningMethodString) {
+			return errors.New("accepted signing method " + method + " cannot be verified with the keys of " + o.SigningMethodString)
+		}
+	}
+
+	entry := keyringEntry{kid: o.KeyID}
+	auth.remoteKeys = nil
+	auth.rotator = nil
+	if o.KeyRotationInterval > 0 {
+		// the keyring is filled by the first rotation below
+		if signingMethodKeyType(o.SigningMethodString) == "" {
+			return errors.New("signing method string not recognized")
+		}
+	} else if o.JWKSURL != "" {
+		// verify keys are fetched from the issuing server instead of read from disk
+		if !o.VerifyOnlyServer {
+			return errors.New("a jwks url can only be used by a verify only server")
+		}
+		if !isPublicKeySigningMethod(o.SigningMethodString) {
+			return errors.New("a jwks url requires a public key signing method")
+		}
+		if o.JWKSCacheTTL <= 0 {
+			o.JWKSCacheTTL = defaultJWKSCacheTTL
+		}
+		if o.JWKSMinRefreshInterval <= 0 {
+			o.JWKSMinRefreshInterval = defaultJWKSMinRefreshInterval
+		}
+
+		auth.remoteKeys = newRemoteKeySet(&o, auth.logger)
+	} else {
+		// record the state of the key files before they're read, so no change can be missed
+		if o.WatchKeyFiles {
+			auth.reloader.fileStates, err = o.statKeyFiles()
+			if err != nil {
+				return err
+			}
+		}
+
+		// create the sign and verify keys
+		entry, err = o.buildKeyPair()
+		if err != nil {
+			return err
+		}
+	}
 
-	auth.signKey = signKey
-	auth.verifyKey = verifyKey
+	auth.keys = newKeyring(entry, o.RefreshTokenValidTime)
 	auth.options = o
 	auth.errorHandler = http.HandlerFunc(defaultErrorHandler)
 	auth.unauthorizedHandler = http.HandlerFunc(defaultUnauthorizedHandler)
+	if o.ProblemDetails {
+		auth.errorHandler = http.HandlerFunc(ProblemDetailsHandler)
+		auth.unauthorizedHandler = http.HandlerFunc(ProblemDetailsHandler)
+	}
 	auth.revokeRefreshToken = TokenRevoker(defaultTokenRevoker)
 	auth.checkTokenId = TokenIdChecker(defaultCheckTokenId)
 
-	jwtGo.MarshalSingleStringAsArray = false
+	if o.KeyRotationInterval > 0 {
+		auth.rotator = newKeyRotator(&o, auth.keys)
+		if err := auth.rotator.rotate(time.Now()); err != nil {
+			return err
+		}
+		auth.startKeyRotation()
+	}
+	if o.WatchKeyFiles {
+		auth.startKeyWatcher(o.KeyWatchInterval)
+	}
 
 	return nil
 }
 
+// buildKeyPair : the sign and verify keys, the kid they're used under, and the certificate
+// chain of the verify key if it was given one
+func (o *Options) buildKeyPair() (entry keyringEntry, err error) {
+	entry.signKey, entry.verifyKey, err = o.buildSignAndVerifyKeys()
+	if err != nil {
+		return
+	}
+
+	entry.certificates, err = o.buildCertificateChain(entry.verifyKey)
+	if err != nil {
+		return
+	}
+
+	// public keys may be published in a jwks, so make sure they can be told apart by kid
+	entry.kid = o.KeyID
+	if entry.kid == "" && !isHMACSigningMethod(o.SigningMethodString) {
+		entry.kid, err = jwkThumbprint(entry.verifyKey)
+	}
+
+	return
+}
+
 func (o *Options) buildSignAndVerifyKeys() (signKey interface{}, verifyKey interface{}, err error) {
 	if o.SigningMethodString == "HS256" || o.SigningMethodString == "HS384" || o.SigningMethodString == "HS512" {
 		return o.buildHMACKeys()
@@ -157,9 +367,16 @@ func (o *Options) buildSignAndVerifyKeys() (signKey interface{}, verifyKey inter
 	} else if o.SigningMethodString == "RS256" || o.SigningMethodString == "RS384" || o.SigningMethodString == "RS512" {
 		return o.buildRSAKeys()
 
+	} else if o.SigningMethodString == "PS256" || o.SigningMethodString == "PS384" || o.SigningMethodString == "PS512" {
+		// RSA-PSS uses the same keys as PKCS#1 v1.5, only the signature scheme differs
+		return o.buildRSAKeys()
+
 	} else if o.SigningMethodString == "ES256" || o.SigningMethodString == "ES384" || o.SigningMethodString == "ES512" {
 		return o.buildESKeys()
 
+	} else if o.SigningMethodString == "EdDSA" {
+		return o.buildEdKeys()
+
 	}
 
 	err = errors.New("signing method string not recognized")
@@ -180,83 +397,24 @@ func (o *Options) buildHMACKeys() (signKey interface{}, verifyKey interface{}, e
 }
 
 func (o *Options) buildRSAKeys() (signKey interface{}, verifyKey interface{}, err error) {
-	var signBytes []byte
-	var verifyBytes []byte
-
-	// check to make sure the provided options are valid
-	if o.PrivateKeyLocation == "" && !o.VerifyOnlyServer {
-		err = errors.New("private key location is required")
-		return
-	}
-	if o.PublicKeyLocation == "" {
-		err = errors.New("public key location is required")
-		return
-	}
-
-	// read the key files
-	if !o.VerifyOnlyServer {
-		signBytes, err = ioutil.ReadFile(o.PrivateKeyLocation)
-		if err != nil {
-			return
-		}
-
-		signKey, err = jwtGo.ParseRSAPrivateKeyFromPEM(signBytes)
-		if err != nil {
-			return
-		}
-	}
-
-	verifyBytes, err = ioutil.ReadFile(o.PublicKeyLocation)
-	if err != nil {
-		return
-	}
-
-	verifyKey, err = jwtGo.ParseRSAPublicKeyFromPEM(verifyBytes)
-	if err != nil {
-		return
-	}
-
-	return
+	return o.buildAsymmetricKeys(
+		func(signBytes []byte) (interface{}, error) { return jwtGo.ParseRSAPrivateKeyFromPEM(signBytes) },
+		func(verifyBytes []byte) (interface{}, error) { return jwtGo.ParseRSAPublicKeyFromPEM(verifyBytes) },
+	)
 }
 
 func (o *Options) buildESKeys() (signKey interface{}, verifyKey interface{}, err error) {
-	var signBytes []byte
-	var verifyBytes []byte
-
-	// check to make sure the provided options are valid
-	if o.PrivateKeyLocation == "" && !o.VerifyOnlyServer {
-		err = errors.New("private key location is required")
-		return
-	}
-	if o.PublicKeyLocation == "" {
-		err = errors.New("public key location is required")
-		return
-	}
-
-	// read the key files
-	if !o.VerifyOnlyServer {
-		signBytes, err = ioutil.ReadFile(o.PrivateKeyLocation)
-		if err != nil {
-			return
-		}
-
-		signKey, err = jwtGo.ParseECPrivateKeyFromPEM(signBytes)
-		if err != nil {
-			return
-		}
-	}
-
-	verifyBytes, err = ioutil.ReadFile(o.PublicKeyLocation)
-	if err != nil {
-		return
-	}
-
-	verifyKey, err = jwtGo.ParseECPublicKeyFromPEM(verifyBytes)
-	if err != nil {
-		return
-	}
+	return o.buildAsymmetricKeys(
+		func(signBytes []byte) (interface{}, error) { return jwtGo.ParseECPrivateKeyFromPEM(signBytes) },
+		func(verifyBytes []byte) (interface{}, error) { return jwtGo.ParseECPublicKeyFromPEM(verifyBytes) },
+	)
+}
 
-	return
+func (o *Options) buildEdKeys() (signKey interface{}, verifyKey interface{}, err error) {
+	return o.buildAsymmetricKeys(
+		func(signBytes []byte) (interface{}, error) { return jwtGo.ParseEdPrivateKeyFromPEM(signBytes) },
+		func(verifyBytes []byte) (interface{}, error) { return jwtGo.ParseEdPublicKeyFromPEM(verifyBytes) },
+	)
 }
 
 // SetErrorHandler : add methods to allow the changing of default functions
@@ -279,19 +437,36 @@ func (a *Auth) SetCheckTokenIdFunction(checker TokenIdChecker) {
 	a.checkTokenId = checker
 }
 
+// SetRotateTokenIdFunction : set the function which is told the jti of the refresh tokens
+// that are issued, and of the ones they replace
+func (a *Auth) SetRotateTokenIdFunction(rotator TokenIdRotator) {
+	a.rotateTokenId = rotator
+}
+
+// logRefused : log why the middleware refused a request; the errors of the server
+// stand out from the unauthorized requests
+func (a *Auth) logRefused(r *http.Request, err *Error) {
+	level := slog.LevelDebug
+	if err.Type/100 != 4 {
+		level = slog.LevelError
+	}
+
+	a.log().Log(r.Context(), level, "request refused", "reason", err.Reason, "error", err.Error(), "status", err.Type, "method", r.Method, "path", r.URL.Path)
+}
+
 // Handler implements the http.HandlerFunc for integration with the standard net/http lib.
 func (a *Auth) Handler(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Process the request. If it returns an error,
 		// that indicates the request should not continue.
-		_, jwtErr := a.Process(w, r)
-		var j jwtError
+		c, jwtErr := a.process(w, r)
 
 		// If there was an error, do not continue.
 		if jwtErr != nil {
-			a.myLog("Error processing jwts\n" + jwtErr.Error())
-			_ = a.NullifyTokens(w, r)
-			if reflect.TypeOf(jwtErr) == reflect.TypeOf(&j) && jwtErr.Type/100 == 4 {
+			a.logRefused(r, jwtErr)
+			_, _ = a.nullifyTokens(w, r)
+			r = requestWithError(r, jwtErr)
+			if jwtErr.Type/100 == 4 {
 				a.unauthorizedHandler.ServeHTTP(w, r)
 				return
 			}
@@ -300,7 +475,7 @@ func (a *Auth) Handler(h http.Handler) http.Handler {
 			return
 		}
 
-		h.ServeHTTP(w, r)
+		h.ServeHTTP(w, a.requestWithCredentials(r, c))
 	})
 }
 
@@ -314,16 +489,16 @@ func (a *Auth) HandlerFunc(fn http.HandlerFunc) http.Handler {
 
 // HandlerFuncWithNext is a special implementation for Negroni, but could be used elsewhere.
 func (a *Auth) HandlerFuncWithNext(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-	_, jwtErr := a.Process(w, r)
-	var j jwtError
+	c, jwtErr := a.process(w, r)
 
 	// If there was an error, do not call next.
 	if jwtErr == nil && next != nil {
-		next(w, r)
+		next(w, a.requestWithCredentials(r, c))
 	} else {
-		a.myLog("Error processing jwts\n" + jwtErr.Error())
-		_ = a.NullifyTokens(w, r)
-		if reflect.TypeOf(jwtErr) == reflect.TypeOf(&j) && jwtErr.Type/100 == 4 {
+		a.logRefused(r, jwtErr)
+		_, _ = a.nullifyTokens(w, r)
+		r = requestWithError(r, jwtErr)
+		if jwtErr.Type/100 == 4 {
 			a.unauthorizedHandler.ServeHTTP(w, r)
 		} else {
 			a.errorHandler.ServeHTTP(w, r)
@@ -332,54 +507,116 @@ func (a *Auth) HandlerFuncWithNext(w http.ResponseWriter, r *http.Request, next
 }
 
 // Process runs the actual checks and returns an error if the middleware chain should stop.
-func (a *Auth) Process(w http.ResponseWriter, r *http.Request) (ClaimsType, *jwtError) {
+func (a *Auth) Process(w http.ResponseWriter, r *http.Request) (ClaimsType, *Error) {
+	c, err := a.process(w, r)
+	if err != nil || c == nil {
+		return ClaimsType{}, err
+	}
+
+	return *c.AuthToken.Token.Claims.(*ClaimsType), nil
+}
+
+// process : Process, returning the verified credentials. There are none for OPTIONS requests.
+func (a *Auth) process(w http.ResponseWriter, r *http.Request) (*credentials, *Error) {
+	ctx, span := a.tracer().Start(r.Context(), "jwt.Process")
+	c, err := a.checkRequest(w, r.WithContext(ctx))
+	if err != nil {
+		a.metrics().RequestProcessed(err.Reason)
+		span.SetAttributes(attribute.String(attributeOutcome, err.Reason))
+
+		// the request is refused anyway, so the hooks can't abort it
+		if errors.Is(err, ErrRefreshRevoked) {
+			_ = a.emit(ctx, credentialsEvent(RefreshRevokedDetected, c, r))
+		}
+		rejected := credentialsEvent(AuthRejected, c, r)
+		rejected.Reason = err.Reason
+		_ = a.emit(ctx, rejected)
+		endSpan(span, err)
+
+		return nil, err
+	}
+
+	if c != nil {
+		a.metrics().RequestProcessed(outcomeAuthorized)
+		span.SetAttributes(attribute.String(attributeOutcome, outcomeAuthorized), attribute.Bool(attributeRefreshed, c.refreshed))
+	}
+	span.End()
+
+	return c, nil
+}
+
+// checkRequest : check the credentials of the request, refreshing them if need-be. The
+// credentials are returned with the error, if they could be read, for the events.
+func (a *Auth) checkRequest(w http.ResponseWriter, r *http.Request) (*credentials, *Error) {
 	// cookies aren't included with options, so simply pass through
 	if r.Method == "OPTIONS" {
-		a.myLog("Method is OPTIONS")
-		return ClaimsType{}, nil
+		a.log().Debug("options request passed through", "path", r.URL.Path)
+		return nil, nil
 	}
 
 	// grab the credentials from the request
 	var c credentials
 	if err := a.buildCredentialsFromRequest(r, &c); err != nil {
-		return ClaimsType{}, newJwtError(err, 500)
+		return nil, newJwtError(err, 500)
 	}
 
 	// check the credential's validity; updating expiry's if necessary and/or allowed
 	if err := c.validateAndUpdateCredentials(); err != nil {
-		return ClaimsType{}, newJwtError(err, 500)
+		return &c, newJwtError(err, 500)
 	}
 
-	a.myLog("Successfully checked / refreshed jwts")
+	// the hooks can refuse refreshed tokens before they're sent
+	if c.refreshed {
+		if err := a.emit(r.Context(), credentialsEvent(TokensRefreshed, &c, r)); err != nil {
+			return &c, err
+		}
+	}
+
+	a.log().Debug("request authorized", append(tokenLogAttrs(c.AuthToken), "path", r.URL.Path)...)
 
 	// if we've made it this far, everything is valid!
 	// And tokens have been refreshed if need-be
 	if !a.options.VerifyOnlyServer {
 		if err := a.setCredentialsOnResponseWriter(w, &c); err != nil {
-			return ClaimsType{}, newJwtError(err, 500)
+			return nil, newJwtError(err, 500)
 		}
 	}
 
-	return *c.AuthToken.Token.Claims.(*ClaimsType), nil
+	return &c, nil
 }
 
 // IssueNewTokens : and also modify create refresh and auth token functions!
 func (a *Auth) IssueNewTokens(w http.ResponseWriter, claims *ClaimsType) error {
+	return a.IssueNewTokensContext(context.Background(), w, claims)
+}
+
+// IssueNewTokensContext : IssueNewTokens, with the spans of issuing the tokens in ctx
+func (a *Auth) IssueNewTokensContext(ctx context.Context, w http.ResponseWriter, claims *ClaimsType) error {
 	if a.options.VerifyOnlyServer {
-		a.myLog("Server is not authorized to issue new tokens")
-		return errors.New("server is not authorized to issue new tokens")
+		a.log().Warn("tokens cannot be issued", "reason", reasonOf(ErrVerifyOnlyServer))
+		return ErrVerifyOnlyServer
 
 	}
 
-	var c credentials
+	ctx, span := a.tracer().Start(ctx, "jwt.IssueNewTokens")
+	c := credentials{ctx: ctx}
 	err := a.buildCredentialsFromClaims(&c, claims)
 	if err != nil {
-		return errors.New(err.Error())
+		endSpan(span, err)
+		return err
+	}
+
+	// the hooks can refuse the tokens before they're sent
+	err = a.emit(ctx, credentialsEvent(TokensIssued, &c, nil))
+	if err != nil {
+		endSpan(span, err)
+		return err
 	}
 
 	err = a.setCredentialsOnResponseWriter(w, &c)
+	endSpan(span, err)
 	if err != nil {
-		return errors.New(err.Error())
+		return err
 	}
 
 	return nil
@@ -388,11 +625,33 @@ func (a *Auth) IssueNewTokens(w http.ResponseWriter, claims *ClaimsType) error {
 // NullifyTokens : invalidate tokens
 // note @adam-hanna: what if there are no credentials in the request?
 func (a *Auth) NullifyTokens(w http.ResponseWriter, r *http.Request) error {
+	ctx, span := a.tracer().Start(r.Context(), "jwt.NullifyTokens")
+	defer span.End()
+
+	c, err := a.nullifyTokens(w, r.WithContext(ctx))
+	if err != nil {
+		var jwtErr *Error
+		if errors.As(err, &jwtErr) {
+			span.SetAttributes(attribute.String(attributeReason, jwtErr.Reason))
+		}
+		return err
+	}
+
+	if err := a.emit(ctx, credentialsEvent(TokensNullified, c, r)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// nullifyTokens : NullifyTokens, without the event; the middleware nullifies the tokens of
+// the requests it refuses, which are events of their own
+func (a *Auth) nullifyTokens(w http.ResponseWriter, r *http.Request) (*credentials, error) {
 	var c credentials
 	err := a.buildCredentialsFromRequest(r, &c)
 	if err != nil {
-		a.myLog("Err building credentials\n" + err.Error())
-		return errors.New(err.Error())
+		a.log().Debug("tokens cannot be nullified", "reason", err.Reason, "error", err.Error())
+		return nil, err
 	}
 
 	if a.options.BearerTokens {
@@ -437,7 +696,12 @@ func (a *Auth) NullifyTokens(w http.ResponseWriter, r *http.Request) error {
 		// http.SetCookie(w, &csrfCookie)
 	}
 
-	if c.RefreshToken != nil {
+	if a.options.RefreshTokenStore != nil {
+		if err := c.deleteRefreshToken(); err != nil {
+			a.log().Error("refresh token cannot be revoked", append(tokenLogAttrs(c.RefreshToken), "error", err.Error())...)
+			return nil, err
+		}
+	} else if c.RefreshToken != nil {
 		refreshTokenClaims := c.RefreshToken.Token.Claims.(*ClaimsType)
 		a.revokeRefreshToken(refreshTokenClaims.RegisteredClaims.ID)
 	}
@@ -446,18 +710,23 @@ func (a *Auth) NullifyTokens(w http.ResponseWriter, r *http.Request) error {
 	setHeader(w, "Auth-Expiry", strconv.FormatInt(time.Now().Add(-1000*time.Hour).Unix(), 10))
 	setHeader(w, "Refresh-Expiry", strconv.FormatInt(time.Now().Add(-1000*time.Hour).Unix(), 10))
 
-	a.myLog("Successfully nullified tokens and csrf string")
-	return nil
+	a.log().Debug("tokens nullified", tokenLogAttrs(c.AuthToken)...)
+	return &c, nil
 }
 
 // GrabTokenClaims : extract the claims from the request
-// note: we always grab from the authToken
+// note: we always grab from the authToken. Behind the middleware, these are the claims it
+// verified, read from the request context.
 func (a *Auth) GrabTokenClaims(r *http.Request) (ClaimsType, error) {
+	if claims, ok := a.claimsFromContext(r.Context()); ok {
+		return claims, nil
+	}
+
 	var c credentials
 	err := a.buildCredentialsFromRequest(r, &c)
 	if err != nil {
-		a.myLog("Err grabbing credentials \n" + err.Error())
-		return ClaimsType{}, errors.New(err.Error())
+		a.log().Debug("credentials cannot be read", "reason", err.Reason, "error", err.Error())
+		return ClaimsType{}, err
 	}
 
 	return *c.AuthToken.Token.Claims.(*ClaimsType), nil
@@ -467,12 +736,18 @@ func (a *Auth) GrabRefreshTokenClaims(r *http.Request) (ClaimsType, error) {
 	var c credentials
 	err := a.buildCredentialsFromRequest(r, &c)
 	if err != nil {
-		a.myLog("Err grabbing credentials \n" + err.Error())
-		return ClaimsType{}, errors.New(err.Error())
+		a.log().Debug("credentials cannot be read", "reason", err.Reason, "error", err.Error())
+		return ClaimsType{}, err
+	}
+
+	if a.options.RefreshTokenStore != nil {
+		if err := c.loadRefreshToken(); err != nil {
+			return ClaimsType{}, err
+		}
 	}
 
 	if c.RefreshToken == nil {
-		return ClaimsType{}, errors.New("Empty refresh token")
+		return ClaimsType{}, newReasonError(ErrRefreshTokenInvalid, nil, 401)
 	}
 
 	return *c.RefreshToken.Token.Claims.(*ClaimsType), nil
@@ -52,15 +52,31 @@ func BenchmarkBaseServer(b *testing.B) {
 }
 
 func BenchmarkValidAuthTokenWithCookies(b *testing.B) {
-	var a Auth
-	authErr := New(&a, Options{
+	benchmarkValidAuthTokenWithCookies(b, Options{
 		SigningMethodString: "HS256",
-		HMACKey: []byte(`#5K+¥¼ƒ~ew{¦Z³(æðTÉ(©„²ÒP.¿ÓûZ’ÒGï–Š´Ãwb="=.!r.OÀÍšõgÐ€£`),
+		HMACKey: []byte(`#5K+¥¼ƒ~ew{¦Z³(æðTÉ(©„²ÒP.¿ÓûZ’ÒGï–Š´Ãwb="=.!r.OÀÍšõgÐ€£`),
 		RefreshTokenValidTime: 72 * time.Hour,
 		AuthTokenValidTime:    15 * time.Minute,
 		Debug:                 false,
 		IsDevEnv:              true,
 	})
+}
+
+func BenchmarkValidAuthTokenWithCookiesEdDSA(b *testing.B) {
+	benchmarkValidAuthTokenWithCookies(b, Options{
+		SigningMethodString:   "EdDSA",
+		PrivateKeyLocation:    "test/ed25519_priv.pem",
+		PublicKeyLocation:     "test/ed25519_pub.pem",
+		RefreshTokenValidTime: 72 * time.Hour,
+		AuthTokenValidTime:    15 * time.Minute,
+		Debug:                 false,
+		IsDevEnv:              true,
+	})
+}
+
+func benchmarkValidAuthTokenWithCookies(b *testing.B, o Options) {
+	var a Auth
+	authErr := New(&a, o)
 	if authErr != nil {
 		b.Errorf("Failed to build jwt server; Err: %v", authErr)
 	}
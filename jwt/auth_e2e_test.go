@@ -6,6 +6,8 @@ import (
 	"net/http/httptest"
 	"testing"
 	"time"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
 )
 
 func recoverHandler(next http.Handler) http.Handler {
@@ -690,4 +692,229 @@ func TestWithInvalidSigningMethod(t *testing.T) {
 	}
 }
 
+func TestWithRefreshTokenAsAuthToken(t *testing.T) {
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString: "HS256",
+		HMACKey: []byte(`#5K+¥¼ƒ~ew{¦Z³(æðTÉ(©„²ÒP.¿ÓûZ’ÒGï–Š´Ãwb="=.!r.OÀÍšõgÐ€£`),
+		RefreshTokenValidTime: 72 * time.Hour,
+		AuthTokenValidTime:    15 * time.Minute,
+		Debug:                 false,
+		IsDevEnv:              true,
+	})
+	if authErr != nil {
+		t.Errorf("Failed to build jwt server; Err: %v", authErr)
+	}
+
+	ts := httptest.NewServer(recoverHandler(a.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Hello, client")
+	}))))
+	defer ts.Close()
+
+	as := httptest.NewServer(recoverHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := ClaimsType{}
+		claims.CustomClaims = make(map[string]interface{})
+		claims.CustomClaims["Role"] = "user"
+
+		a.IssueNewTokens(w, &claims)
+		fmt.Fprintln(w, "Hello, client")
+	})))
+	defer as.Close()
+
+	res, err := http.Get(as.URL)
+	if err != nil {
+		t.Errorf("Couldn't send request to test server; Err: %v", err)
+	}
+
+	var refreshTokenString string
+	for _, cookie := range res.Cookies() {
+		if cookie.Name == a.options.RefreshTokenName {
+			refreshTokenString = cookie.Value
+		}
+	}
+
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	if err != nil {
+		t.Errorf("Couldn't build request; Err: %v", err)
+	}
+
+	// the refresh token carries the same csrf string and outlives the auth token
+	req.AddCookie(&http.Cookie{Name: a.options.AuthTokenName, Value: refreshTokenString})
+	req.Header.Add(a.options.CSRFTokenName, res.Header.Get(a.options.CSRFTokenName))
+
+	// send the request
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Errorf("Couldn't send request to test server; Err: %v", err)
+	}
+
+	if resp.StatusCode != 401 {
+		t.Errorf("Expected status code 401, received: %d", resp.StatusCode)
+	}
+}
+
+func TestWithAuthTokenAsRefreshToken(t *testing.T) {
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString: "HS256",
+		HMACKey: []byte(`#5K+¥¼ƒ~ew{¦Z³(æðTÉ(©„²ÒP.¿ÓûZ’ÒGï–Š´Ãwb="=.!r.OÀÍšõgÐ€£`),
+		RefreshTokenValidTime: 72 * time.Hour,
+		AuthTokenValidTime:    15 * time.Minute,
+		UpdateTokenClaims:     func(claims *ClaimsType) ClaimsType { return *claims },
+		Debug:                 false,
+		IsDevEnv:              true,
+	})
+	if authErr != nil {
+		t.Errorf("Failed to build jwt server; Err: %v", authErr)
+	}
+
+	ts := httptest.NewServer(recoverHandler(a.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Hello, client")
+	}))))
+	defer ts.Close()
+
+	as := httptest.NewServer(recoverHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := ClaimsType{}
+		claims.CustomClaims = make(map[string]interface{})
+		claims.CustomClaims["Role"] = "user"
+
+		a.IssueNewTokens(w, &claims)
+		fmt.Fprintln(w, "Hello, client")
+	})))
+	defer as.Close()
+
+	res, err := http.Get(as.URL)
+	if err != nil {
+		t.Errorf("Couldn't send request to test server; Err: %v", err)
+	}
+
+	var authTokenString string
+	var refreshTokenString string
+	for _, cookie := range res.Cookies() {
+		if cookie.Name == a.options.AuthTokenName {
+			authTokenString = cookie.Value
+		}
+		if cookie.Name == a.options.RefreshTokenName {
+			refreshTokenString = cookie.Value
+		}
+	}
+
+	// without an auth token, the refresh token is used to issue new tokens...
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	if err != nil {
+		t.Errorf("Couldn't build request; Err: %v", err)
+	}
+
+	req.AddCookie(&http.Cookie{Name: a.options.AuthTokenName, Value: ""})
+	req.AddCookie(&http.Cookie{Name: a.options.RefreshTokenName, Value: refreshTokenString})
+	req.Header.Add(a.options.CSRFTokenName, res.Header.Get(a.options.CSRFTokenName))
+
+	// send the request
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Errorf("Couldn't send request to test server; Err: %v", err)
+	}
+
+	if resp.StatusCode != 200 {
+		t.Errorf("Expected status code 200, received: %d", resp.StatusCode)
+	}
+
+	// ...but a stolen auth token can't be used in its place
+	req, err = http.NewRequest("GET", ts.URL, nil)
+	if err != nil {
+		t.Errorf("Couldn't build request; Err: %v", err)
+	}
+
+	req.AddCookie(&http.Cookie{Name: a.options.AuthTokenName, Value: ""})
+	req.AddCookie(&http.Cookie{Name: a.options.RefreshTokenName, Value: authTokenString})
+	req.Header.Add(a.options.CSRFTokenName, res.Header.Get(a.options.CSRFTokenName))
+
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Errorf("Couldn't send request to test server; Err: %v", err)
+	}
+
+	if resp.StatusCode != 401 {
+		t.Errorf("Expected status code 401, received: %d", resp.StatusCode)
+	}
+}
+
 // test bearer tokens?
+
+func TestWithWrongTokenTypeHeader(t *testing.T) {
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString:   "HS256",
+		HMACKey:               []byte("test key"),
+		RefreshTokenValidTime: 72 * time.Hour,
+		AuthTokenValidTime:    15 * time.Minute,
+		UpdateTokenClaims:     func(claims *ClaimsType) ClaimsType { return *claims },
+		Debug:                 false,
+		IsDevEnv:              true,
+	})
+	if authErr != nil {
+		t.Errorf("Failed to build jwt server; Err: %v", authErr)
+	}
+
+	ts := httptest.NewServer(recoverHandler(a.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Hello, client")
+	}))))
+	defer ts.Close()
+
+	// the token_use claim of each token is right, only the typ header differs
+	signToken := func(use string, typ string) string {
+		claims := ClaimsType{Csrf: "csrf", TokenUse: use}
+		claims.ExpiresAt = jwtGo.NewNumericDate(time.Now().Add(time.Hour))
+		token := jwtGo.NewWithClaims(jwtGo.SigningMethodHS256, &claims)
+		if typ == "" {
+			delete(token.Header, "typ")
+		} else {
+			token.Header["typ"] = typ
+		}
+
+		tokenString, err := a.encodeToken(token)
+		if err != nil {
+			t.Fatalf("Unable to sign token; Err: %v", err)
+		}
+		return tokenString
+	}
+
+	var tests = []struct {
+		name               string
+		authTokenString    string
+		refreshTokenString string
+		expectedStatusCode int
+	}{
+		{"typed auth token", signToken(tokenUseAccess, "at+jwt"), "", 200},
+		{"auth token typed as a media type", signToken(tokenUseAccess, "application/AT+JWT"), "", 200},
+		{"untyped auth token", signToken(tokenUseAccess, ""), "", 401},
+		{"auth token typed JWT", signToken(tokenUseAccess, "JWT"), "", 401},
+		{"refresh token typed JWT", "", signToken(tokenUseRefresh, "JWT"), 200},
+		{"refresh token typed at+jwt", "", signToken(tokenUseRefresh, "at+jwt"), 401},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", ts.URL, nil)
+		if err != nil {
+			t.Errorf("Couldn't build request; Err: %v", err)
+		}
+
+		req.AddCookie(&http.Cookie{Name: a.options.AuthTokenName, Value: test.authTokenString})
+		req.AddCookie(&http.Cookie{Name: a.options.RefreshTokenName, Value: test.refreshTokenString})
+		req.Header.Add(a.options.CSRFTokenName, "csrf")
+
+		// send the request
+		client := &http.Client{}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Errorf("Couldn't send request to test server; Err: %v", err)
+			continue
+		}
+
+		if resp.StatusCode != test.expectedStatusCode {
+			t.Errorf("[%s] Expected status code %d, received: %d", test.name, test.expectedStatusCode, resp.StatusCode)
+		}
+	}
+}
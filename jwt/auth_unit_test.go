@@ -88,6 +88,33 @@ var newAuthTests = []struct {
 		},
 		false,
 	},
+	{
+		Options{
+			SigningMethodString: "PS256",
+			PrivateKeyLocation:  "test/priv.rsa",
+			PublicKeyLocation:   "test/priv.rsa.pub",
+			VerifyOnlyServer:    false,
+		},
+		true,
+	},
+	{
+		Options{
+			SigningMethodString:  "PS256",
+			AcceptSigningMethods: []string{"RS256"},
+			PublicKeyLocation:    "test/priv.rsa.pub",
+			VerifyOnlyServer:     true,
+		},
+		true,
+	},
+	{
+		Options{
+			SigningMethodString:  "RS256",
+			AcceptSigningMethods: []string{"ES256"},
+			PublicKeyLocation:    "test/priv.rsa.pub",
+			VerifyOnlyServer:     true,
+		},
+		false,
+	},
 	{
 		Options{
 			SigningMethodString: "ES256",
@@ -271,7 +298,7 @@ func TestSetRevokeTokenFunction(t *testing.T) {
 	}
 }
 
-func MyCheckRefreshToken(jti string) bool {
+func MyCheckRefreshToken(claims *ClaimsType) bool {
 	return false
 }
 func TestSetCheckTokenIdFunction(t *testing.T) {
@@ -281,12 +308,12 @@ func TestSetCheckTokenIdFunction(t *testing.T) {
 		t.Errorf("Building auth faild when passed valid options; Err: %v; options: %v", authErr, newAuthTests[0].options)
 	}
 
-	if !a.checkTokenId("test") {
+	if !a.checkTokenId(&ClaimsType{}) {
 		t.Error("Checked default token id function; Expected: true; Received: false")
 	}
 
 	a.SetCheckTokenIdFunction(MyCheckRefreshToken)
-	if a.checkTokenId("test") {
+	if a.checkTokenId(&ClaimsType{}) {
 		t.Error("Checked custom token id function; Expected: false; Received: true")
 	}
 }
@@ -337,11 +364,11 @@ func TestNullifyTokens(t *testing.T) {
 		t.Errorf("Unable to build credentials; Err: %v", err)
 	}
 
-	authTokenString, authStringErr := c.AuthToken.Token.SignedString(a.signKey)
+	authTokenString, authStringErr := a.signToken(c.AuthToken.Token)
 	if authStringErr != nil {
 		t.Errorf("Unable to build credentials; Err: %v", authStringErr)
 	}
-	refreshTokenString, refreshStringErr := c.RefreshToken.Token.SignedString(a.signKey)
+	refreshTokenString, refreshStringErr := a.signToken(c.RefreshToken.Token)
 	if refreshStringErr != nil {
 		t.Errorf("Unable to build credentials; Err: %v", refreshStringErr)
 	}
@@ -420,7 +447,7 @@ func TestNullifyTokens(t *testing.T) {
 
 	// finally, check to make sure the refresh token id is being revoked
 	refreshTokenClaims := c.RefreshToken.Token.Claims.(*ClaimsType)
-	if a.checkTokenId(refreshTokenClaims.RegisteredClaims.ID) {
+	if a.checkTokenId(refreshTokenClaims) {
 		t.Error("Expected refresh token id to have been revoked")
 	}
 }
@@ -442,11 +469,11 @@ func TestGrabTokenClaims(t *testing.T) {
 		t.Errorf("Unable to build credentials; Err: %v", err)
 	}
 
-	authTokenString, authStringErr := c.AuthToken.Token.SignedString(a.signKey)
+	authTokenString, authStringErr := a.signToken(c.AuthToken.Token)
 	if authStringErr != nil {
 		t.Errorf("Unable to build credentials; Err: %v", authStringErr)
 	}
-	refreshTokenString, refreshStringErr := c.RefreshToken.Token.SignedString(a.signKey)
+	refreshTokenString, refreshStringErr := a.signToken(c.RefreshToken.Token)
 	if refreshStringErr != nil {
 		t.Errorf("Unable to build credentials; Err: %v", refreshStringErr)
 	}
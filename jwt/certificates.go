@@ -0,0 +1,186 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"time"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
+)
+
+// parseCertificatesPEM : the certificates in PEM data that starts with a "CERTIFICATE" block,
+// e.g. a chain as written by most certificate tooling, leaf first. PEM data holding anything
+// else returns no certificates.
+func parseCertificatesPEM(pemBytes []byte) ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, pemBytes = pem.Decode(pemBytes)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			if len(certificates) == 0 {
+				return nil, nil
+			}
+			continue
+		}
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	return certificates, nil
+}
+
+// defaultCertificateKeyUsages : the extended key usages a certificate of a verify key must allow,
+// unless CertificateKeyUsages is set. Certificates without the extension allow any usage.
+var defaultCertificateKeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+
+// buildCertificateChain : when the public key has been given as a certificate chain, the chain
+// is validated against CertificateRoots and returned
+func (o *Options) buildCertificateChain(verifyKey interface{}) ([]*x509.Certificate, error) {
+	if isHMACSigningMethod(o.SigningMethodString) || (len(o.PublicKeyPEM) == 0 && o.PublicKeyLocation == "") {
+		return nil, nil
+	}
+
+	verifyBytes := o.PublicKeyPEM
+	if len(verifyBytes) == 0 {
+		var err error
+		verifyBytes, err = o.readKeyFile(o.PublicKeyLocation)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	certificates, err := parseCertificatesPEM(verifyBytes)
+	if err != nil || len(certificates) == 0 {
+		return nil, err
+	}
+
+	if o.CertificateRoots == nil {
+		return nil, errors.New("a certificate chain given as the public key requires CertificateRoots")
+	}
+	if err := verifyCertificateChain(certificates, o.CertificateRoots, o.CertificateKeyUsages, time.Now()); err != nil {
+		return nil, err
+	}
+
+	// the file may have been rewritten since the key was read from it
+	publicKey, ok := certificates[0].PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !publicKey.Equal(verifyKey) {
+		return nil, errors.New("certificate does not match the public key")
+	}
+
+	return certificates, nil
+}
+
+// verifyCertificateChain : make sure the leaf certificate chains to one of the roots, through
+// the other certificates, that every certificate is valid at the given time, and that the
+// chain allows one of the key usages. The system roots are never used, a certificate they
+// trust may have been issued to anyone.
+func verifyCertificateChain(certificates []*x509.Certificate, roots *x509.CertPool, keyUsages []x509.ExtKeyUsage, now time.Time) error {
+	if len(certificates) == 0 {
+		return errors.New("no certificate found")
+	}
+	if roots == nil {
+		return errors.New("no certificate roots to verify the chain with")
+	}
+	if len(keyUsages) == 0 {
+		keyUsages = defaultCertificateKeyUsages
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+
+	_, err := certificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     keyUsages,
+	})
+
+	return err
+}
+
+func checkCertificateValidity(certificate *x509.Certificate, now time.Time) error {
+	if now.Before(certificate.NotBefore) || now.After(certificate.NotAfter) {
+		return errors.New("certificate of the verify key is not valid at this time")
+	}
+
+	return nil
+}
+
+// certificateThumbprint : the x5t#S256 of a certificate, https://tools.ietf.org/html/rfc7515#section-4.1.8
+func certificateThumbprint(certificate *x509.Certificate) string {
+	sum := sha256.Sum256(certificate.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// encodeCertificateChain : the x5c of a certificate chain, https://tools.ietf.org/html/rfc7515#section-4.1.6
+func encodeCertificateChain(certificates []*x509.Certificate) []string {
+	chain := make([]string, 0, len(certificates))
+	for _, certificate := range certificates {
+		chain = append(chain, base64.StdEncoding.EncodeToString(certificate.Raw))
+	}
+
+	return chain
+}
+
+// x5cKeyResolver : verifies tokens that carry their certificate chain in the x5c header with
+// the key of the leaf certificate, as long as the chain leads to a trusted root. Other tokens
+// are verified as usual.
+type x5cKeyResolver struct {
+	roots               *x509.CertPool
+	keyUsages           []x509.ExtKeyUsage
+	signingMethodString string
+	next                keyResolver
+}
+
+func (r *x5cKeyResolver) verifyKeyForToken(token *jwtGo.Token) (interface{}, error) {
+	header, ok := token.Header["x5c"]
+	if !ok {
+		return r.next.verifyKeyForToken(token)
+	}
+
+	encoded, ok := header.([]interface{})
+	if !ok || len(encoded) == 0 {
+		return nil, errors.New("x5c in token header is not a certificate chain")
+	}
+
+	certificates := make([]*x509.Certificate, 0, len(encoded))
+	for _, value := range encoded {
+		s, ok := value.(string)
+		if !ok {
+			return nil, errors.New("x5c in token header is not a certificate chain")
+		}
+		der, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		certificate, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	if err := verifyCertificateChain(certificates, r.roots, r.keyUsages, time.Now()); err != nil {
+		return nil, err
+	}
+
+	verifyKey := certificates[0].PublicKey
+	if err := checkKeyTypes(r.signingMethodString, nil, verifyKey); err != nil {
+		return nil, err
+	}
+
+	return verifyKey, nil
+}
@@ -0,0 +1,190 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testCertificate : issue a certificate for key, signed by parent (self signed when parent is nil)
+func testCertificate(t *testing.T, name string, key crypto.Signer, parent *x509.Certificate, parentKey crypto.Signer, isCA bool, notAfter time.Time, extKeyUsages ...x509.ExtKeyUsage) *x509.Certificate {
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatalf("Unable to generate serial number: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           extKeyUsages,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatalf("Unable to create certificate: %v", err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Unable to parse certificate: %v", err)
+	}
+
+	return certificate
+}
+
+func testECKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate ECDSA key: %v", err)
+	}
+
+	return key
+}
+
+func encodeCertificatesPEM(certificates ...*x509.Certificate) []byte {
+	var pemBytes []byte
+	for _, certificate := range certificates {
+		pemBytes = append(pemBytes, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})...)
+	}
+
+	return pemBytes
+}
+
+func TestCertificateChain(t *testing.T) {
+	validUntil := time.Now().Add(24 * time.Hour)
+	rootKey, intermediateKey, leafKey := testECKey(t), testECKey(t), testECKey(t)
+	root := testCertificate(t, "root", rootKey, nil, nil, true, validUntil)
+	intermediate := testCertificate(t, "intermediate", intermediateKey, root, rootKey, true, validUntil)
+	leaf := testCertificate(t, "leaf", leafKey, intermediate, intermediateKey, false, validUntil)
+	expiredLeaf := testCertificate(t, "expired", leafKey, intermediate, intermediateKey, false, time.Now().Add(-time.Minute))
+	clientLeaf := testCertificate(t, "client", leafKey, intermediate, intermediateKey, false, validUntil, x509.ExtKeyUsageClientAuth)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(testCertificate(t, "other root", testECKey(t), nil, nil, true, validUntil))
+
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString:   "ES256",
+		PrivateKey:            leafKey,
+		PublicKeyPEM:          encodeCertificatesPEM(leaf, intermediate),
+		CertificateRoots:      roots,
+		EmbedCertificateChain: true,
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+
+	var c credentials
+	var claims ClaimsType
+	if err := a.buildCredentialsFromClaims(&c, &claims); err != nil {
+		t.Errorf("Unable to build credentials; Err: %v", err)
+	}
+	tokenString, signErr := a.signToken(c.AuthToken.Token)
+	if signErr != nil {
+		t.Fatalf("Unable to sign auth token; Err: %v", signErr)
+	}
+	if c.AuthToken.Token.Header["x5t#S256"] != certificateThumbprint(leaf) {
+		t.Errorf("Expected the certificate thumbprint in the token header; Received: %v", c.AuthToken.Token.Header["x5t#S256"])
+	}
+
+	set, err := a.JWKS()
+	if err != nil || len(set.Keys) != 1 || len(set.Keys[0].X5c) != 2 || set.Keys[0].X5tS256 != certificateThumbprint(leaf) {
+		t.Errorf("Expected the certificate chain in the jwks; Received: %+v; Err: %v", set, err)
+	}
+
+	// a token signed with the key of a client certificate
+	var clientSigner Auth
+	authErr = New(&clientSigner, Options{
+		SigningMethodString:   "ES256",
+		PrivateKey:            leafKey,
+		PublicKeyPEM:          encodeCertificatesPEM(clientLeaf, intermediate),
+		CertificateRoots:      roots,
+		CertificateKeyUsages:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		EmbedCertificateChain: true,
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+	var clientCredentials credentials
+	if err := clientSigner.buildCredentialsFromClaims(&clientCredentials, &claims); err != nil {
+		t.Errorf("Unable to build credentials; Err: %v", err)
+	}
+	clientTokenString, signErr := clientSigner.signToken(clientCredentials.AuthToken.Token)
+	if signErr != nil {
+		t.Fatalf("Unable to sign auth token; Err: %v", signErr)
+	}
+
+	// verify only servers accept tokens carrying a chain to one of their roots, for one of
+	// the key usages they allow
+	var verifyTests = []struct {
+		name        string
+		tokenString string
+		roots       *x509.CertPool
+		keyUsages   []x509.ExtKeyUsage
+		valid       bool
+	}{
+		{"trusted root", tokenString, roots, nil, true},
+		{"untrusted root", tokenString, otherRoots, nil, false},
+		{"client certificate", clientTokenString, roots, nil, false},
+		{"allowed client certificate", clientTokenString, roots, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, true},
+		{"other key usage", tokenString, roots, []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}, true},
+		{"client certificate for another key usage", clientTokenString, roots, []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}, false},
+	}
+	for _, test := range verifyTests {
+		var v Auth
+		authErr := New(&v, Options{
+			SigningMethodString:  "ES256",
+			VerifyOnlyServer:     true,
+			PublicKey:            &testECKey(t).PublicKey,
+			CertificateRoots:     test.roots,
+			CertificateKeyUsages: test.keyUsages,
+		})
+		if authErr != nil {
+			t.Fatalf("Unable to build jwt auth for testing; test: %s; Err: %v", test.name, authErr)
+		}
+
+		var verify credentials
+		if err := v.buildCredentialsFromStrings(c.CsrfString, test.tokenString, "", &verify); err != nil {
+			t.Errorf("Unable to build credentials; test: %s; Err: %v", test.name, err)
+		}
+		if (verify.AuthToken.ParseErr == nil) != test.valid {
+			t.Errorf("Unexpected result verifying a token with an x5c header; test: %s; Err: %v", test.name, verify.AuthToken.ParseErr)
+		}
+	}
+
+	var chainTests = []struct {
+		name    string
+		options Options
+	}{
+		{"untrusted root", Options{SigningMethodString: "ES256", PrivateKey: leafKey, PublicKeyPEM: encodeCertificatesPEM(leaf, intermediate), CertificateRoots: otherRoots}},
+		{"missing intermediate", Options{SigningMethodString: "ES256", PrivateKey: leafKey, PublicKeyPEM: encodeCertificatesPEM(leaf), CertificateRoots: roots}},
+		{"expired certificate", Options{SigningMethodString: "ES256", PrivateKey: leafKey, PublicKeyPEM: encodeCertificatesPEM(expiredLeaf, intermediate), CertificateRoots: roots}},
+		{"hmac", Options{SigningMethodString: "HS256", HMACKey: []byte("test key"), CertificateRoots: roots}},
+		{"no roots", Options{SigningMethodString: "ES256", PrivateKey: leafKey, PublicKeyPEM: encodeCertificatesPEM(leaf, intermediate)}},
+		{"embedded chain without roots", Options{SigningMethodString: "ES256", PrivateKey: leafKey, PublicKey: &leafKey.PublicKey, EmbedCertificateChain: true}},
+		{"client certificate", Options{SigningMethodString: "ES256", PrivateKey: leafKey, PublicKeyPEM: encodeCertificatesPEM(clientLeaf, intermediate), CertificateRoots: roots}},
+		{"any key usage", Options{SigningMethodString: "ES256", PrivateKey: leafKey, PublicKeyPEM: encodeCertificatesPEM(leaf, intermediate), CertificateRoots: roots, CertificateKeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}},
+	}
+	for _, test := range chainTests {
+		var b Auth
+		if err := New(&b, test.options); err == nil {
+			t.Errorf("Expected an error building jwt auth; test: %s", test.name)
+		}
+	}
+}
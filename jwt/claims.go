@@ -0,0 +1,176 @@
+package jwt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
+)
+
+// claimsTypeFields : the claims that have a field of their own in ClaimsType
+var claimsTypeFields = map[string]bool{
+	"uid":       true,
+	"csrf":      true,
+	"token_use": true,
+	"iss":       true,
+	"sub":       true,
+	"aud":       true,
+	"exp":       true,
+	"nbf":       true,
+	"iat":       true,
+	"jti":       true,
+}
+
+// nestedCustomClaimsField : where the custom claims are kept when they aren't flattened
+const nestedCustomClaimsField = "CustomClaims"
+
+// claimsTypeFieldsOnly : ClaimsType without its json methods, so they can use the default encoding
+type claimsTypeFieldsOnly ClaimsType
+
+// claimsTypeEncoding : the default encoding of ClaimsType, but for the audience
+type claimsTypeEncoding struct {
+	claimsTypeFieldsOnly
+	Audience audienceClaim `json:"aud,omitempty"`
+}
+
+// audienceClaim : an aud claim encoded as a string when there's a single audience, the way
+// most verifiers expect it. jwtGo.MarshalSingleStringAsArray would do the same, but for every
+// user of jwtGo in the process.
+type audienceClaim jwtGo.ClaimStrings
+
+func (a audienceClaim) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// encodeClaimsFields : the default encoding of the fields of the claims
+func encodeClaimsFields(fields claimsTypeFieldsOnly) ([]byte, error) {
+	return json.Marshal(claimsTypeEncoding{claimsTypeFieldsOnly: fields, Audience: audienceClaim(fields.Audience)})
+}
+
+// MarshalJSON : the default encoding, unless the custom claims are flattened into the
+// top level of the payload
+func (c ClaimsType) MarshalJSON() ([]byte, error) {
+	if !c.flattenCustomClaims {
+		return encodeClaimsFields(claimsTypeFieldsOnly(c))
+	}
+
+	fields := claimsTypeFieldsOnly(c)
+	fields.CustomClaims = nil
+	encoded, err := encodeClaimsFields(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(encoded, &payload); err != nil {
+		return nil, err
+	}
+	delete(payload, nestedCustomClaimsField)
+	for name, value := range c.CustomClaims {
+		// a custom claim must not be taken for one the server manages
+		if claimsTypeFields[name] || name == nestedCustomClaimsField {
+			return nil, errors.New("custom claim " + name + " conflicts with a claim of the token")
+		}
+
+		payload[name], err = json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(payload)
+}
+
+// UnmarshalJSON : the default decoding, unless the custom claims are flattened. Then every
+// claim without a field of its own is collected into CustomClaims, along with the custom
+// claims of tokens issued before they were flattened. The json of the custom claims is kept,
+// so they can be read into a struct without going through float64 (see TypedAuth).
+func (c *ClaimsType) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*claimsTypeFieldsOnly)(c)); err != nil {
+		return err
+	}
+	c.customClaimsJSON = nil
+
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+	customClaims := make(map[string]json.RawMessage)
+	if nested, ok := payload[nestedCustomClaimsField]; ok && string(nested) != "null" {
+		if err := json.Unmarshal(nested, &customClaims); err != nil {
+			return err
+		}
+	}
+
+	if c.flattenCustomClaims {
+		for name, value := range payload {
+			if claimsTypeFields[name] || name == nestedCustomClaimsField {
+				continue
+			}
+
+			var decoded interface{}
+			if err := json.Unmarshal(value, &decoded); err != nil {
+				return err
+			}
+			if c.CustomClaims == nil {
+				c.CustomClaims = make(map[string]interface{})
+			}
+			c.CustomClaims[name] = decoded
+			customClaims[name] = value
+		}
+	}
+
+	if c.CustomClaims != nil {
+		encoded, err := json.Marshal(customClaims)
+		if err != nil {
+			return err
+		}
+		c.customClaimsJSON = encoded
+	}
+
+	return nil
+}
+
+// customClaimsEncoding : the json of the custom claims. Each claim that wasn't changed since
+// it was read or written is encoded as it was then, so numbers keep their precision.
+func (c *ClaimsType) customClaimsEncoding() ([]byte, error) {
+	if c.customClaimsJSON == nil {
+		return json.Marshal(c.CustomClaims)
+	}
+
+	var original map[string]json.RawMessage
+	if err := json.Unmarshal(c.customClaimsJSON, &original); err != nil {
+		return json.Marshal(c.CustomClaims)
+	}
+
+	customClaims := make(map[string]json.RawMessage, len(c.CustomClaims))
+	for name, value := range c.CustomClaims {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		customClaims[name] = encoded
+
+		// the map holds the json decoded the default way, unless the claim was changed
+		var decoded interface{}
+		if raw, ok := original[name]; ok && json.Unmarshal(raw, &decoded) == nil {
+			if reencoded, err := json.Marshal(decoded); err == nil && bytes.Equal(reencoded, encoded) {
+				customClaims[name] = raw
+			}
+		}
+	}
+
+	return json.Marshal(customClaims)
+}
+
+// unmarshalJSONNumbers : json.Unmarshal, with the numbers decoded as json.Number instead of
+// float64, so integers above 2^53 keep their precision
+func unmarshalJSONNumbers(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
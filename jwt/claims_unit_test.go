@@ -0,0 +1,105 @@
+package jwt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClaimsTypeJSON(t *testing.T) {
+	var marshalTests = []struct {
+		flatten  bool
+		expected string
+	}{
+		{false, `{"uid":"1","sub":"user","CustomClaims":{"role":"admin"}}`},
+		{true, `{"role":"admin","sub":"user","uid":"1"}`},
+	}
+
+	for idx, test := range marshalTests {
+		claims := ClaimsType{UID: "1", CustomClaims: map[string]interface{}{"role": "admin"}, flattenCustomClaims: test.flatten}
+		claims.Subject = "user"
+		encoded, err := json.Marshal(&claims)
+		if err != nil {
+			t.Errorf("Unable to marshal claims; idx: %d; Err: %v", idx, err)
+		}
+		if string(encoded) != test.expected {
+			t.Errorf("Unexpected claims encoding; idx: %d; Expected: %s; Received: %s", idx, test.expected, encoded)
+		}
+	}
+
+	// custom claims can't take the place of the claims the server manages
+	claims := ClaimsType{CustomClaims: map[string]interface{}{"exp": 0}, flattenCustomClaims: true}
+	if _, err := json.Marshal(&claims); err == nil {
+		t.Error("Expected an error marshalling a custom claim named like a registered claim")
+	}
+
+	// foreign claims are collected, and so are the nested custom claims of older tokens
+	payload := `{"sub":"user","role":"admin","scope":["read"],"CustomClaims":{"level":3}}`
+	var unmarshalTests = []struct {
+		flatten  bool
+		expected map[string]interface{}
+	}{
+		{false, map[string]interface{}{"level": float64(3)}},
+		{true, map[string]interface{}{"level": float64(3), "role": "admin", "scope": []interface{}{"read"}}},
+	}
+
+	for idx, test := range unmarshalTests {
+		decoded := ClaimsType{flattenCustomClaims: test.flatten}
+		if err := json.Unmarshal([]byte(payload), &decoded); err != nil {
+			t.Errorf("Unable to unmarshal claims; idx: %d; Err: %v", idx, err)
+		}
+		if decoded.Subject != "user" || len(decoded.CustomClaims) != len(test.expected) {
+			t.Errorf("Unexpected claims; idx: %d; Received: %v", idx, decoded.CustomClaims)
+		}
+		for name, value := range test.expected {
+			expected, _ := json.Marshal(value)
+			received, _ := json.Marshal(decoded.CustomClaims[name])
+			if string(expected) != string(received) {
+				t.Errorf("Unexpected custom claim; idx: %d; name: %s; Received: %s", idx, name, received)
+			}
+		}
+	}
+}
+
+func TestFlattenCustomClaims(t *testing.T) {
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString: "HS256",
+		HMACKey:             []byte("test key"),
+		FlattenCustomClaims: true,
+		BearerTokens:        true,
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+
+	claims := ClaimsType{CustomClaims: map[string]interface{}{"role": "admin"}}
+	w := httptest.NewRecorder()
+	if err := a.IssueNewTokens(w, &claims); err != nil {
+		t.Fatalf("Unable to issue tokens; Err: %v", err)
+	}
+
+	authTokenString := w.Header().Get(a.options.AuthTokenName)
+	payload, err := base64.RawURLEncoding.DecodeString(strings.Split(authTokenString, ".")[1])
+	if err != nil {
+		t.Fatalf("Unable to decode the token payload; Err: %v", err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		t.Fatalf("Unable to decode the token payload; Err: %v", err)
+	}
+	if fields["role"] != "admin" || fields[nestedCustomClaimsField] != nil {
+		t.Errorf("Expected the custom claims at the top level of the payload; Received: %s", payload)
+	}
+
+	var c credentials
+	if err := a.buildCredentialsFromStrings(w.Header().Get(a.options.CSRFTokenName), authTokenString, "", &c); err != nil {
+		t.Errorf("Unable to build credentials; Err: %v", err)
+	}
+	tokenClaims := c.AuthToken.Token.Claims.(*ClaimsType)
+	if !c.AuthToken.Token.Valid || len(tokenClaims.CustomClaims) != 1 || tokenClaims.CustomClaims["role"] != "admin" {
+		t.Errorf("Expected the custom claims to be read from the top level; Received: %v", tokenClaims.CustomClaims)
+	}
+}
@@ -0,0 +1,83 @@
+package jwt
+
+import (
+	"context"
+	"net/http"
+)
+
+type contextKey int
+
+const (
+	credentialsContextKey contextKey = iota
+	errorContextKey
+)
+
+// contextCredentials : what the middleware verified, for the handlers it wraps
+type contextCredentials struct {
+	auth            *Auth
+	claims          ClaimsType
+	authTokenString string
+}
+
+// requestWithCredentials : the request, with the claims of its verified (or freshly refreshed)
+// auth token in its context
+func (a *Auth) requestWithCredentials(r *http.Request, c *credentials) *http.Request {
+	if c == nil {
+		return r
+	}
+
+	claims, ok := c.AuthToken.Token.Claims.(*ClaimsType)
+	if !ok {
+		return r
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), credentialsContextKey, &contextCredentials{
+		auth:            a,
+		claims:          *claims,
+		authTokenString: c.AuthTokenString,
+	}))
+}
+
+// ClaimsFromContext : the claims of the auth token verified by the middleware, in the context
+// of the requests passed to the handlers it wraps. If the tokens were refreshed, these are the
+// claims of the new auth token.
+func ClaimsFromContext(ctx context.Context) (ClaimsType, bool) {
+	cc, ok := ctx.Value(credentialsContextKey).(*contextCredentials)
+	if !ok {
+		return ClaimsType{}, false
+	}
+
+	return cc.claims, true
+}
+
+// TokenFromContext : the auth token verified by the middleware, as it's held by the client
+func TokenFromContext(ctx context.Context) (string, bool) {
+	cc, ok := ctx.Value(credentialsContextKey).(*contextCredentials)
+	if !ok {
+		return "", false
+	}
+
+	return cc.authTokenString, true
+}
+
+// claimsFromContext : the claims verified by this Auth, if it's the middleware of the request
+func (a *Auth) claimsFromContext(ctx context.Context) (ClaimsType, bool) {
+	cc, ok := ctx.Value(credentialsContextKey).(*contextCredentials)
+	if !ok || cc.auth != a {
+		return ClaimsType{}, false
+	}
+
+	return cc.claims, true
+}
+
+// requestWithError : the request, with the reason it was refused in its context
+func requestWithError(r *http.Request, err *Error) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), errorContextKey, err))
+}
+
+// ErrorFromContext : why the middleware refused the request, in the context of the requests
+// passed to the unauthorized and error handlers
+func ErrorFromContext(ctx context.Context) (*Error, bool) {
+	err, ok := ctx.Value(errorContextKey).(*Error)
+	return err, ok && err != nil
+}
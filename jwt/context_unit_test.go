@@ -0,0 +1,83 @@
+package jwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
+)
+
+func TestClaimsFromContext(t *testing.T) {
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString: "HS256",
+		HMACKey:             []byte("test key"),
+		BearerTokens:        true,
+		UpdateTokenClaims:   func(claims *ClaimsType) ClaimsType { return *claims },
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+
+	claims := ClaimsType{CustomClaims: map[string]interface{}{"role": "admin"}}
+	w := httptest.NewRecorder()
+	if err := a.IssueNewTokens(w, &claims); err != nil {
+		t.Fatalf("Unable to issue tokens; Err: %v", err)
+	}
+	csrf := w.Header().Get(a.options.CSRFTokenName)
+
+	var (
+		contextClaims  ClaimsType
+		contextToken   string
+		grabbedClaims  ClaimsType
+		foundInContext bool
+	)
+	handler := a.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contextClaims, foundInContext = ClaimsFromContext(r.Context())
+		contextToken, _ = TokenFromContext(r.Context())
+		grabbedClaims, _ = a.GrabTokenClaims(r)
+	}))
+
+	newRequest := func(method string, authTokenString string) *http.Request {
+		req, reqErr := http.NewRequest(method, "http://localhost:8080/", nil)
+		if reqErr != nil {
+			t.Fatalf("Error building request for testing; err: %v", reqErr)
+		}
+		req.Header.Set(a.options.AuthTokenName, authTokenString)
+		req.Header.Set(a.options.RefreshTokenName, w.Header().Get(a.options.RefreshTokenName))
+		req.Header.Set(a.options.CSRFTokenName, csrf)
+		return req
+	}
+
+	authTokenString := w.Header().Get(a.options.AuthTokenName)
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("GET", authTokenString))
+	if !foundInContext || contextClaims.CustomClaims["role"] != "admin" || contextToken != authTokenString {
+		t.Errorf("Expected the verified claims in the request context; Received: %+v", contextClaims)
+	}
+
+	// the handler sees the claims of a refreshed token, not the expired ones of the request
+	expiredClaims := ClaimsType{Csrf: csrf, TokenUse: tokenUseAccess}
+	expiredClaims.ExpiresAt = jwtGo.NewNumericDate(time.Now().Add(-time.Minute))
+	expiredAuthTokenString, err := a.encodeToken(newAuthTokenWithClaims(jwtGo.SigningMethodHS256, &expiredClaims))
+	if err != nil {
+		t.Fatalf("Unable to sign auth token; Err: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", expiredAuthTokenString))
+	if contextToken != rec.Header().Get(a.options.AuthTokenName) || contextClaims.ExpiresAt.Before(time.Now()) {
+		t.Errorf("Expected the refreshed token in the request context; Received: %s", contextToken)
+	}
+	if grabbedClaims.ID != contextClaims.ID || grabbedClaims.CustomClaims["role"] != "admin" {
+		t.Errorf("Expected GrabTokenClaims to read the claims from the request context; Received: %+v", grabbedClaims)
+	}
+
+	// there are no claims without a token
+	foundInContext = true
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("OPTIONS", ""))
+	if foundInContext {
+		t.Error("Expected no claims in the context of an OPTIONS request")
+	}
+}
@@ -1,12 +1,15 @@
 package jwt
 
 import (
+	"context"
 	"errors"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/adam-hanna/randomstrings"
 	jwtGo "github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type credentials struct {
@@ -15,6 +18,18 @@ type credentials struct {
 	AuthToken    *jwtToken
 	RefreshToken *jwtToken
 
+	// the auth token as it's held by the client: the one of the request, or the newly issued one
+	AuthTokenString string
+
+	// an opaque refresh token, as sent by the client; its claims are only looked up when needed
+	RefreshTokenReference string
+
+	// the context of the request or call the credentials were built for, for its spans
+	ctx context.Context
+	// whether the tokens were refreshed, and the jti of the refresh token they were refreshed with
+	refreshed              bool
+	previousRefreshTokenId string
+
 	options credentialsOptions
 }
 
@@ -22,24 +37,45 @@ type credentialsOptions struct {
 	AuthTokenValidTime    time.Duration
 	RefreshTokenValidTime time.Duration
 
-	CheckTokenId TokenIdChecker
+	CheckTokenId      TokenIdChecker
+	RotateTokenId     TokenIdRotator
+	RefreshTokenStore RefreshTokenStore
 
-	SigningMethodString string
+	SigningMethodString  string
+	AcceptSigningMethods []string
+	TokenCodec           tokenCodec
 
 	VerifyOnlyServer bool
 
 	UpdateTokenClaims TokenClaimsGenerator
+	Issuer            string
+	Audience          string
+	ParserOptions     []jwtGo.ParserOption
 
-	Debug bool
+	FlattenCustomClaims bool
+
+	Logger         *slog.Logger
+	Metrics        Metrics
+	TracerProvider trace.TracerProvider
 }
 
-func (c *credentials) myLog(stoofs interface{}) {
-	if c.options.Debug {
-		log.Println(stoofs)
+// log : the logger of the Auth the credentials were built by
+func (c *credentials) log() *slog.Logger {
+	if c.options.Logger == nil {
+		return defaultLogger()
 	}
+	return c.options.Logger
 }
 
-func (a *Auth) buildCredentialsFromClaims(c *credentials, claims *ClaimsType) *jwtError {
+// metrics : the metrics of the Auth the credentials were built by
+func (c *credentials) metrics() Metrics {
+	if c.options.Metrics == nil {
+		return noopMetrics{}
+	}
+	return c.options.Metrics
+}
+
+func (a *Auth) buildCredentialsFromClaims(c *credentials, claims *ClaimsType) *Error {
 	newCsrfString, err := generateNewCsrfString()
 	if err != nil {
 		return newJwtError(err, 500)
@@ -49,25 +85,71 @@ func (a *Auth) buildCredentialsFromClaims(c *credentials, claims *ClaimsType) *j
 	c.options.AuthTokenValidTime = a.options.AuthTokenValidTime
 	c.options.RefreshTokenValidTime = a.options.RefreshTokenValidTime
 	c.options.CheckTokenId = a.checkTokenId
+	c.options.RotateTokenId = a.rotateTokenId
+	c.options.RefreshTokenStore = a.options.RefreshTokenStore
 	c.options.VerifyOnlyServer = a.options.VerifyOnlyServer
 	c.options.SigningMethodString = a.options.SigningMethodString
+	c.options.AcceptSigningMethods = a.options.AcceptSigningMethods
+	c.options.TokenCodec = a.codec
 	c.options.UpdateTokenClaims = a.options.UpdateTokenClaims
-	c.options.Debug = a.options.Debug
+	c.options.Issuer = a.options.Issuer
+	c.options.Audience = a.options.Audience
+	c.options.ParserOptions = a.options.parserOptions()
+	c.options.FlattenCustomClaims = a.options.FlattenCustomClaims
+	c.options.Logger = a.logger
+	c.options.Metrics = a.options.Metrics
+	c.options.TracerProvider = a.options.TracerProvider
+
+	return c.newTokensWithClaims(*claims)
+}
+
+// newTokensWithClaims : the auth and refresh tokens for the claims and the csrf string of the
+// credentials. Each token gets its own id, and the registered claims managed by the server
+// replace the ones the caller passed. The id of the refresh token is passed to RotateTokenId,
+// along with the one of the refresh token it replaces.
+func (c *credentials) newTokensWithClaims(claims ClaimsType) *Error {
+	now := time.Now()
+
+	claims.Csrf = c.CsrfString
+	claims.flattenCustomClaims = c.options.FlattenCustomClaims
+	claims.IssuedAt = jwtGo.NewNumericDate(now)
+	claims.NotBefore = jwtGo.NewNumericDate(now)
+	if c.options.Issuer != "" {
+		claims.Issuer = c.options.Issuer
+	}
+	if c.options.Audience != "" {
+		claims.Audience = jwtGo.ClaimStrings{c.options.Audience}
+	}
 
-	authClaims := *claims
-	authClaims.Csrf = newCsrfString
-	authClaims.RegisteredClaims.ExpiresAt = jwtGo.NewNumericDate(time.Now().Add(a.options.AuthTokenValidTime))
-	c.AuthToken = c.newTokenWithClaims(&authClaims, a.options.AuthTokenValidTime)
+	authTokenId, err := generateTokenId()
+	if err != nil {
+		return err
+	}
+	authClaims := claims
+	authClaims.ID = authTokenId
+	authClaims.TokenUse = tokenUseAccess
+	authClaims.RegisteredClaims.ExpiresAt = jwtGo.NewNumericDate(now.Add(c.options.AuthTokenValidTime))
+	c.AuthToken = c.newTokenWithClaims(&authClaims, c.options.AuthTokenValidTime)
 
-	refreshClaimsClaims := *claims
-	refreshClaimsClaims.Csrf = newCsrfString
-	refreshClaimsClaims.RegisteredClaims.ExpiresAt = jwtGo.NewNumericDate(time.Now().Add(a.options.RefreshTokenValidTime))
-	c.RefreshToken = c.newTokenWithClaims(&refreshClaimsClaims, a.options.RefreshTokenValidTime)
+	refreshTokenId, err := generateTokenId()
+	if err != nil {
+		return err
+	}
+	if c.options.RotateTokenId != nil {
+		if err := c.options.RotateTokenId(c.previousRefreshTokenId, refreshTokenId); err != nil {
+			return newJwtError(err, 500)
+		}
+	}
+	refreshClaimsClaims := claims
+	refreshClaimsClaims.ID = refreshTokenId
+	refreshClaimsClaims.TokenUse = tokenUseRefresh
+	refreshClaimsClaims.RegisteredClaims.ExpiresAt = jwtGo.NewNumericDate(now.Add(c.options.RefreshTokenValidTime))
+	c.RefreshToken = c.newTokenWithClaims(&refreshClaimsClaims, c.options.RefreshTokenValidTime)
 
 	return nil
 }
 
-func (a *Auth) buildCredentialsFromStrings(csrfString string, authTokenString string, refreshTokenString string, c *credentials) *jwtError {
+func (a *Auth) buildCredentialsFromStrings(csrfString string, authTokenString string, refreshTokenString string, c *credentials) *Error {
 	// check inputs
 	//if csrfString == "" || authTokenString == "" || refreshTokenString == "" {
 	//return newJwtError(errors.New("Invalid inputs to build credentials. Inputs cannot be blank"), 401)
@@ -75,30 +157,45 @@ func (a *Auth) buildCredentialsFromStrings(csrfString string, authTokenString st
 
 	// inputs are good
 	c.CsrfString = csrfString
+	c.AuthTokenString = authTokenString
 
 	c.options.AuthTokenValidTime = a.options.AuthTokenValidTime
 	c.options.RefreshTokenValidTime = a.options.RefreshTokenValidTime
 	c.options.CheckTokenId = a.checkTokenId
+	c.options.RotateTokenId = a.rotateTokenId
+	c.options.RefreshTokenStore = a.options.RefreshTokenStore
 	c.options.VerifyOnlyServer = a.options.VerifyOnlyServer
 	c.options.SigningMethodString = a.options.SigningMethodString
+	c.options.AcceptSigningMethods = a.options.AcceptSigningMethods
+	c.options.TokenCodec = a.codec
 	c.options.UpdateTokenClaims = a.options.UpdateTokenClaims
-	c.options.Debug = a.options.Debug
+	c.options.Issuer = a.options.Issuer
+	c.options.Audience = a.options.Audience
+	c.options.ParserOptions = a.options.parserOptions()
+	c.options.FlattenCustomClaims = a.options.FlattenCustomClaims
+	c.options.Logger = a.logger
+	c.options.Metrics = a.options.Metrics
+	c.options.TracerProvider = a.options.TracerProvider
 
 	// Note: Don't check for errors because it will be done later
 	//       Also, tokens that have expired will throw err?
-	c.AuthToken = c.buildTokenWithClaimsFromString(authTokenString, a.verifyKey, a.options.AuthTokenValidTime)
+	c.AuthToken = c.verifyToken(authTokenString, a.keyResolver(), a.options.AuthTokenValidTime, tokenUseAccess)
 
 	if refreshTokenString != "" {
-		c.RefreshToken = c.buildTokenWithClaimsFromString(refreshTokenString, a.verifyKey, a.options.RefreshTokenValidTime)
+		if a.options.RefreshTokenStore != nil {
+			c.RefreshTokenReference = refreshTokenString
+		} else {
+			c.RefreshToken = c.verifyToken(refreshTokenString, a.keyResolver(), a.options.RefreshTokenValidTime, tokenUseRefresh)
+		}
 	}
 
 	return nil
 }
 
-func (c *credentials) validateCsrfStringAgainstCredentials() *jwtError {
+func (c *credentials) validateCsrfStringAgainstCredentials() *Error {
 	authTokenClaims, ok := c.AuthToken.Token.Claims.(*ClaimsType)
 	if !ok {
-		return newJwtError(errors.New("cannot read token claims"), 500)
+		return newReasonError(ErrInvalidClaims, nil, 500)
 	}
 	// note @adam-hanna: check csrf in refresh token? Careful! These tokens are
 	// 									 coming from a request, and the csrf in the credential may have been
@@ -108,13 +205,13 @@ func (c *credentials) validateCsrfStringAgainstCredentials() *jwtError {
 	// 	return newJwtError(errors.New("Cannot read token claims"), 500)
 	// }
 	if c.CsrfString != authTokenClaims.Csrf {
-		return newJwtError(errors.New("CSRF token doesn't match value in auth token"), 401)
+		return newReasonError(ErrCSRFMismatch, nil, 401)
 	}
 
 	return nil
 }
 
-func generateNewCsrfString() (string, *jwtError) {
+func generateNewCsrfString() (string, *Error) {
 	// note @adam-hanna: allow user's to set length?
 	newCsrf, err := randomstrings.GenerateRandomString(32)
 	if err != nil {
@@ -124,28 +221,45 @@ func generateNewCsrfString() (string, *jwtError) {
 	return newCsrf, nil
 }
 
-func (c *credentials) updateAuthTokenFromRefreshToken() *jwtError {
+// generateTokenId : a random jti, so every token can be told apart and revoked
+func generateTokenId() (string, *Error) {
+	tokenId, err := randomstrings.GenerateRandomString(32)
+	if err != nil {
+		return "", newJwtError(err, 500)
+	}
+
+	return tokenId, nil
+}
+
+func (c *credentials) updateAuthTokenFromRefreshToken() *Error {
+	// opaque refresh tokens are only looked up when they're used
+	opaque := c.options.RefreshTokenStore != nil
+	if opaque {
+		if err := c.loadRefreshToken(); err != nil {
+			return err
+		}
+	}
+
 	if c.RefreshToken == nil || c.RefreshToken.Token == nil {
-		return newJwtError(errors.New("refresh token is invalid. Cannot refresh auth token"), 401)
+		return newReasonError(ErrRefreshTokenInvalid, nil, 401)
 	}
 
 	refreshTokenClaims, ok := c.RefreshToken.Token.Claims.(*ClaimsType)
 	if !ok {
-		return newJwtError(errors.New("cannot read refresh token claims"), 500)
+		return newReasonError(ErrInvalidClaims, nil, 500)
 	}
 
 	// verify csrf value in refresh token
 	if c.CsrfString != refreshTokenClaims.Csrf {
-		return newJwtError(errors.New("CSRF token doesn't match value in refresh token"), 401)
+		return newReasonError(ErrCSRFMismatch, nil, 401)
 	}
 
-	// check if the refresh token has been revoked
-	if c.options.CheckTokenId(refreshTokenClaims) {
+	// check if the refresh token has been revoked; opaque ones are revoked by deleting them
+	if opaque || c.checkRefreshTokenId(refreshTokenClaims) {
 		// if c.options.CheckTokenId(refreshTokenClaims.RegisteredClaims.ID) {
-		c.myLog("Refresh token has not been revoked")
 		// has it expired?
 		if c.RefreshToken.Token.Valid {
-			c.myLog("Refresh token is not expired")
+			c.log().Debug("refreshing tokens", tokenLogAttrs(c.RefreshToken)...)
 			// nope, the refresh token has not expired
 			// issue a new tokens with a new csrf and update all expiries
 			newCsrfString, err := generateNewCsrfString()
@@ -155,18 +269,19 @@ func (c *credentials) updateAuthTokenFromRefreshToken() *jwtError {
 
 			c.CsrfString = newCsrfString
 
-			claims := c.options.UpdateTokenClaims(refreshTokenClaims)
-
-			authClaims := claims
-			authClaims.Csrf = newCsrfString
-			authClaims.RegisteredClaims.ExpiresAt = jwtGo.NewNumericDate(time.Now().Add(c.options.AuthTokenValidTime))
-			c.AuthToken = c.newTokenWithClaims(&authClaims, c.options.AuthTokenValidTime)
-
-			refreshClaimsClaims := claims
-			refreshClaimsClaims.Csrf = newCsrfString
-			refreshClaimsClaims.RegisteredClaims.ExpiresAt = jwtGo.NewNumericDate(time.Now().Add(c.options.RefreshTokenValidTime))
-			c.RefreshToken = c.newTokenWithClaims(&refreshClaimsClaims, c.options.RefreshTokenValidTime)
+			// opaque refresh tokens are used once, and replaced by the new one
+			if opaque {
+				if err := c.takeRefreshToken(); err != nil {
+					return err
+				}
+			}
 
+			c.previousRefreshTokenId = refreshTokenClaims.ID
+			if err := c.newTokensWithClaims(c.updateTokenClaims(refreshTokenClaims)); err != nil {
+				return err
+			}
+			c.refreshed = true
+			c.metrics().TokensRefreshed()
 			return nil
 
 			// err = c.AuthToken.updateTokenExpiryAndCsrf(newCsrfString)
@@ -178,16 +293,41 @@ func (c *credentials) updateAuthTokenFromRefreshToken() *jwtError {
 			// return err
 		}
 
-		c.myLog("Refresh token is invalid")
-		return newJwtError(errors.New("refresh token is invalid. Cannot refresh auth token"), 401)
+		c.log().Debug("refresh token is invalid", append(tokenLogAttrs(c.RefreshToken), "reason", reasonOf(ErrRefreshTokenInvalid))...)
+		return newReasonError(ErrRefreshTokenInvalid, c.RefreshToken.ParseErr, 401)
 	}
 
-	c.myLog("Refresh token has been revoked")
-	return newJwtError(errors.New("refresh token has been revoked. Cannot update auth token"), 401)
+	// a revoked token that's still used may have been stolen
+	c.log().Warn("refresh token has been revoked", append(tokenLogAttrs(c.RefreshToken), "reason", reasonOf(ErrRefreshRevoked))...)
+	return newReasonError(ErrRefreshRevoked, nil, 401)
+
+}
+
+// checkRefreshTokenId : CheckTokenId, timed and in a span
+func (c *credentials) checkRefreshTokenId(claims *ClaimsType) bool {
+	_, span := c.tracer().Start(c.context(), "jwt.revocation_check")
+	defer span.End()
+
+	start := time.Now()
+	valid := c.options.CheckTokenId(claims)
+	c.metrics().RevocationChecked(time.Since(start))
+	span.SetAttributes(attribute.Bool(attributeValid, valid))
 
+	return valid
 }
 
-func (c *credentials) validateAndUpdateCredentials() *jwtError {
+// updateTokenClaims : UpdateTokenClaims, in a span. Without one, the claims are kept as they are.
+func (c *credentials) updateTokenClaims(claims *ClaimsType) ClaimsType {
+	_, span := c.tracer().Start(c.context(), "jwt.update_claims")
+	defer span.End()
+
+	if c.options.UpdateTokenClaims == nil {
+		return *claims
+	}
+	return c.options.UpdateTokenClaims(claims)
+}
+
+func (c *credentials) validateAndUpdateCredentials() *Error {
 	// first, check that the csrf token matches what's in the jwts
 	err := c.validateCsrfStringAgainstCredentials()
 	// if err != nil {
@@ -197,7 +337,6 @@ func (c *credentials) validateAndUpdateCredentials() *jwtError {
 	// next, check the auth token in a stateless manner
 	if err == nil && c.AuthToken.Token.Valid {
 		// auth token has not expired and is valid
-		c.myLog("Auth token has not expired and is valid")
 
 		// note @ adam-hanna: we want this to be purely stateless
 		// 									  don't update any tokens, here
@@ -223,13 +362,12 @@ func (c *credentials) validateAndUpdateCredentials() *jwtError {
 		// }
 		return nil
 	} else {
-		c.myLog("Auth token is not valid")
-		if errors.Is(err, jwtGo.ErrTokenExpired) || errors.Is(c.AuthToken.ParseErr, jwtGo.ErrTokenExpired) || (err != nil && err.Type == 401) {
+		if errors.Is(c.AuthToken.ParseErr, ErrTokenExpired) || (err != nil && err.Type == 401) {
 			if err != nil && err.Type == 401 {
 				// csrf string is not present in Auth token
-				c.myLog(err.Error())
+				c.log().Debug("csrf string doesn't match the auth token", append(tokenLogAttrs(c.AuthToken), "reason", err.Reason, "csrf", c.CsrfString)...)
 			} else {
-				c.myLog("Auth token is expired")
+				c.log().Debug("auth token is expired", tokenLogAttrs(c.AuthToken)...)
 			}
 			if !c.options.VerifyOnlyServer {
 				// attempt to update the tokens
@@ -237,11 +375,19 @@ func (c *credentials) validateAndUpdateCredentials() *jwtError {
 				return err
 			}
 
-			c.myLog("Auth token is expired and server is not authorized to issue new tokens")
-			return newJwtError(errors.New("Auth token is expired and server is not authorized to issue new tokens"), 401)
+			if errors.Is(c.AuthToken.ParseErr, ErrTokenExpired) {
+				return newReasonError(ErrTokenExpired, ErrVerifyOnlyServer, 401)
+			}
+			// a csrf mismatch of an otherwise valid token
+			if c.AuthToken.ParseErr == nil {
+				return err
+			}
 		}
 
-		c.myLog("Error in auth token")
-		return newJwtError(errors.New("Auth token is not valid, and not because it has expired"), 401)
+		c.log().Debug("auth token is invalid", "error", c.AuthToken.ParseErr)
+		if c.AuthTokenString == "" {
+			return newReasonError(ErrNoAuthToken, nil, 401)
+		}
+		return newReasonError(ErrTokenInvalid, c.AuthToken.ParseErr, 401)
 	}
 }
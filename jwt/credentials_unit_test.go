@@ -1,14 +1,23 @@
 package jwt
 
 import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
 )
 
 var revokedTokens map[string]string
 
-func CheckRefreshToken(jti string) bool {
-	return revokedTokens[jti] == ""
+func CheckRefreshToken(claims *ClaimsType) bool {
+	return revokedTokens[claims.RegisteredClaims.ID] == ""
 }
 func RevokeRefreshToken(jti string) error {
 	revokedTokens[jti] = "revoked"
@@ -52,7 +61,7 @@ func TestBuildCredentialsFromClaims(t *testing.T) {
 		c.options.RefreshTokenValidTime != a.options.RefreshTokenValidTime ||
 		c.options.VerifyOnlyServer != a.options.VerifyOnlyServer ||
 		c.options.SigningMethodString != a.options.SigningMethodString ||
-		c.options.Debug != a.options.Debug {
+		c.options.Logger != a.logger {
 		t.Error("Credentials were not built with necessary info from Auth")
 	}
 
@@ -92,7 +101,7 @@ func TestBuildCredentialsFromStrings(t *testing.T) {
 		c.options.RefreshTokenValidTime != a.options.RefreshTokenValidTime ||
 		c.options.VerifyOnlyServer != a.options.VerifyOnlyServer ||
 		c.options.SigningMethodString != a.options.SigningMethodString ||
-		c.options.Debug != a.options.Debug {
+		c.options.Logger != a.logger {
 		t.Error("Credentials were not built with necessary info from Auth")
 	}
 
@@ -173,11 +182,11 @@ func TestUpdateAuthTokenFromRefreshToken(t *testing.T) {
 		t.Errorf("Unable to build credentials; Err: %v", err)
 	}
 	// note: now need to build from strings, bc token.Valid is only true if parsed
-	authTokenString, authStringErr := c.AuthToken.Token.SignedString(a.signKey)
+	authTokenString, authStringErr := a.signToken(c.AuthToken.Token)
 	if authStringErr != nil {
 		t.Errorf("Unable to build credentials; Err: %v", authStringErr)
 	}
-	refreshTokenString, refreshStringErr := c.RefreshToken.Token.SignedString(a.signKey)
+	refreshTokenString, refreshStringErr := a.signToken(c.RefreshToken.Token)
 	if refreshStringErr != nil {
 		t.Errorf("Unable to build credentials; Err: %v", refreshStringErr)
 	}
@@ -235,11 +244,11 @@ func TestValidateAndUpdateCredentials(t *testing.T) {
 		t.Errorf("Unable to build credentials; Err: %v", err)
 	}
 	// note: now need to build from strings, bc token.Valid is only true if parsed
-	authTokenString, authStringErr := c.AuthToken.Token.SignedString(a.signKey)
+	authTokenString, authStringErr := a.signToken(c.AuthToken.Token)
 	if authStringErr != nil {
 		t.Errorf("Unable to build credentials; Err: %v", authStringErr)
 	}
-	refreshTokenString, refreshStringErr := c.RefreshToken.Token.SignedString(a.signKey)
+	refreshTokenString, refreshStringErr := a.signToken(c.RefreshToken.Token)
 	if refreshStringErr != nil {
 		t.Errorf("Unable to build credentials; Err: %v", refreshStringErr)
 	}
@@ -360,11 +369,11 @@ func TestValidateAndUpdateCredentials(t *testing.T) {
 	duration = time.Duration(1) * time.Second // Pause for 1 second
 	time.Sleep(duration)
 	// note: now need to build from strings, bc token.Valid is only true if parsed
-	authTokenString, authStringErr = c.AuthToken.Token.SignedString(a.signKey)
+	authTokenString, authStringErr = a.signToken(c.AuthToken.Token)
 	if authStringErr != nil {
 		t.Errorf("Unable to build credentials; Err: %v", authStringErr)
 	}
-	refreshTokenString, refreshStringErr = c.RefreshToken.Token.SignedString(a.signKey)
+	refreshTokenString, refreshStringErr = a.signToken(c.RefreshToken.Token)
 	if refreshStringErr != nil {
 		t.Errorf("Unable to build credentials; Err: %v", refreshStringErr)
 	}
@@ -374,7 +383,7 @@ func TestValidateAndUpdateCredentials(t *testing.T) {
 	}
 	c.options.VerifyOnlyServer = true
 	err = c.validateAndUpdateCredentials()
-	if err == nil || err.Error() != "Auth token is expired and server is not authorized to issue new tokens" {
+	if !errors.Is(err, ErrTokenExpired) || !errors.Is(err, ErrVerifyOnlyServer) {
 		t.Errorf("Auth token is not valid, and server is not allowed to update tokens but did or experienced some other err; Err: %v", err)
 	}
 
@@ -414,3 +423,179 @@ func TestValidateAndUpdateCredentials(t *testing.T) {
 		t.Errorf("Expected refresh expiry to be updated: old: %v; new: %v", oldRefreshExpiry, newRefreshExpiry)
 	}
 }
+
+func TestRegisteredClaims(t *testing.T) {
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString: "HS256",
+		HMACKey:             []byte("test key"),
+		Issuer:              "https://auth.example.com",
+		Audience:            "https://api.example.com",
+		Leeway:              time.Minute,
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+
+	// the server's registered claims replace the caller's
+	var c credentials
+	claims := ClaimsType{}
+	claims.Issuer = "someone else"
+	claims.ID = "reused id"
+	if err := a.buildCredentialsFromClaims(&c, &claims); err != nil {
+		t.Fatalf("Unable to build credentials; Err: %v", err)
+	}
+	authClaims := c.AuthToken.Token.Claims.(*ClaimsType)
+	refreshClaims := c.RefreshToken.Token.Claims.(*ClaimsType)
+	if authClaims.ID == "" || authClaims.ID == claims.ID || authClaims.ID == refreshClaims.ID {
+		t.Errorf("Expected every token to get its own id; Received: %s, %s", authClaims.ID, refreshClaims.ID)
+	}
+	if authClaims.IssuedAt == nil || authClaims.NotBefore == nil || refreshClaims.IssuedAt == nil {
+		t.Error("Expected the iat and nbf claims to be set")
+	}
+	if authClaims.Issuer != a.options.Issuer || len(authClaims.Audience) != 1 || authClaims.Audience[0] != a.options.Audience {
+		t.Errorf("Expected the iss and aud claims to be set; Received: %s, %v", authClaims.Issuer, authClaims.Audience)
+	}
+
+	authTokenString, err := a.encodeToken(c.AuthToken.Token)
+	if err != nil {
+		t.Fatalf("Unable to sign auth token; Err: %v", err)
+	}
+	// a single audience is encoded as a string, without changing how jwtGo encodes it for others
+	payload, err := base64.RawURLEncoding.DecodeString(strings.Split(authTokenString, ".")[1])
+	if err != nil || !strings.Contains(string(payload), `"aud":"https://api.example.com"`) {
+		t.Errorf("Expected a single audience to be encoded as a string; Received: %s", payload)
+	}
+	if !jwtGo.MarshalSingleStringAsArray {
+		t.Error("Expected the jwtGo encoding of audiences to be left as it is")
+	}
+	if err := a.buildCredentialsFromStrings(c.CsrfString, authTokenString, "", &c); err != nil {
+		t.Errorf("Unable to build credentials; Err: %v", err)
+	}
+	if !c.AuthToken.Token.Valid {
+		t.Errorf("Expected the auth token to be valid; Err: %v", c.AuthToken.ParseErr)
+	}
+
+	// tokens of another issuer or for another audience are refused
+	var optionTests = []struct {
+		name     string
+		issuer   string
+		audience string
+	}{
+		{"issuer", "https://other.example.com", "https://api.example.com"},
+		{"audience", "https://auth.example.com", "https://other.example.com"},
+	}
+	for _, test := range optionTests {
+		var other Auth
+		if err := New(&other, Options{SigningMethodString: "HS256", HMACKey: []byte("test key"), Issuer: test.issuer, Audience: test.audience}); err != nil {
+			t.Fatalf("Unable to build jwt auth for testing; Err: %v", err)
+		}
+		if err := other.buildCredentialsFromStrings(c.CsrfString, authTokenString, "", &c); err != nil {
+			t.Errorf("Unable to build credentials; Err: %v", err)
+		}
+		if c.AuthToken.Token.Valid {
+			t.Errorf("Expected a token with the wrong %s to be refused", test.name)
+		}
+	}
+
+	// the leeway allows for clock skew between servers
+	authClaims.ExpiresAt = jwtGo.NewNumericDate(time.Now().Add(-30 * time.Second))
+	expiredTokenString, err := a.encodeToken(newAuthTokenWithClaims(jwtGo.SigningMethodHS256, authClaims))
+	if err != nil {
+		t.Fatalf("Unable to sign auth token; Err: %v", err)
+	}
+	if err := a.buildCredentialsFromStrings(c.CsrfString, expiredTokenString, "", &c); err != nil {
+		t.Errorf("Unable to build credentials; Err: %v", err)
+	}
+	if !c.AuthToken.Token.Valid {
+		t.Errorf("Expected a token expired within the leeway to be valid; Err: %v", c.AuthToken.ParseErr)
+	}
+
+	var negative Auth
+	if err := New(&negative, Options{SigningMethodString: "HS256", HMACKey: []byte("test key"), Leeway: -time.Second}); err == nil {
+		t.Error("Expected an error building jwt auth with a negative leeway")
+	}
+}
+
+func TestRotateTokenId(t *testing.T) {
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString: "HS256",
+		HMACKey:             []byte("test key"),
+		BearerTokens:        true,
+		UpdateTokenClaims:   func(claims *ClaimsType) ClaimsType { return *claims },
+		// the reuse of the refresh token is logged
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+
+	// a whitelist of the refresh tokens that can be used
+	whitelist := make(map[string]bool)
+	a.SetRotateTokenIdFunction(func(previousTokenId string, tokenId string) error {
+		delete(whitelist, previousTokenId)
+		whitelist[tokenId] = true
+		return nil
+	})
+	a.SetCheckTokenIdFunction(func(claims *ClaimsType) bool {
+		return whitelist[claims.ID]
+	})
+
+	w := httptest.NewRecorder()
+	if err := a.IssueNewTokens(w, &ClaimsType{}); err != nil {
+		t.Fatalf("Unable to issue tokens; Err: %v", err)
+	}
+	if len(whitelist) != 1 {
+		t.Fatalf("Expected the refresh token to be whitelisted; Received: %v", whitelist)
+	}
+	var issuedTokenId string
+	for tokenId := range whitelist {
+		issuedTokenId = tokenId
+	}
+
+	csrf := w.Header().Get(a.options.CSRFTokenName)
+	expiredClaims := ClaimsType{Csrf: csrf, TokenUse: tokenUseAccess}
+	expiredClaims.ExpiresAt = jwtGo.NewNumericDate(time.Now().Add(-time.Minute))
+	expiredAuthTokenString, err := a.encodeToken(newAuthTokenWithClaims(jwtGo.SigningMethodHS256, &expiredClaims))
+	if err != nil {
+		t.Fatalf("Unable to sign auth token; Err: %v", err)
+	}
+	refresh := func(refreshTokenString string, csrf string) (*httptest.ResponseRecorder, *Error) {
+		req, reqErr := http.NewRequest("GET", "http://localhost:8080/", nil)
+		if reqErr != nil {
+			t.Fatalf("Error building request for testing; err: %v", reqErr)
+		}
+		req.Header.Set(a.options.AuthTokenName, expiredAuthTokenString)
+		req.Header.Set(a.options.RefreshTokenName, refreshTokenString)
+		req.Header.Set(a.options.CSRFTokenName, csrf)
+		rec := httptest.NewRecorder()
+		_, err := a.Process(rec, req)
+		return rec, err
+	}
+
+	// the new refresh token replaces the one it was refreshed with
+	rec, jwtErr := refresh(w.Header().Get(a.options.RefreshTokenName), csrf)
+	if jwtErr != nil {
+		t.Fatalf("Expected the whitelisted refresh token to refresh the tokens; Err: %v", jwtErr)
+	}
+	if len(whitelist) != 1 || whitelist[issuedTokenId] {
+		t.Errorf("Expected only the new refresh token to be whitelisted; Received: %v", whitelist)
+	}
+
+	// so the used one can't be used again
+	if _, jwtErr := refresh(w.Header().Get(a.options.RefreshTokenName), csrf); !errors.Is(jwtErr, ErrRefreshRevoked) {
+		t.Errorf("Expected the used refresh token to be refused; Err: %v", jwtErr)
+	}
+
+	// a failing rotation fails the refresh
+	a.SetRotateTokenIdFunction(func(previousTokenId string, tokenId string) error {
+		return errors.New("whitelist is down")
+	})
+	// the expired auth token carries the old csrf, and the refresh token the new one
+	if _, jwtErr := refresh(rec.Header().Get(a.options.RefreshTokenName), rec.Header().Get(a.options.CSRFTokenName)); jwtErr == nil || jwtErr.Type != 500 {
+		t.Errorf("Expected the refresh to fail; Err: %v", jwtErr)
+	} else if jwtErr.Error() != "whitelist is down" {
+		t.Errorf("Expected the error of the rotation; Err: %v", jwtErr)
+	}
+}
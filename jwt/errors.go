@@ -1,33 +1,125 @@
 package jwt
 
 import (
-	"reflect"
+	"errors"
+	"fmt"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
 )
 
-// Helper for constructing a ValidationError with a string error message
-func newJwtError(err interface{}, errType int) *jwtError {
-	var j jwtError
+// Errors of the middleware. They're returned wrapped in an *Error, and can be checked
+// with errors.Is.
+var (
+	ErrNoAuthToken         = errors.New("no auth token")
+	ErrNoCSRFToken         = errors.New("no CSRF string")
+	ErrCSRFMismatch        = errors.New("CSRF token doesn't match value in token")
+	ErrTokenInvalid        = errors.New("auth token is not valid")
+	ErrTokenExpired        = jwtGo.ErrTokenExpired
+	ErrWrongSigningMethod  = errors.New("incorrect signing method on token")
+	ErrWrongTokenType      = errors.New("token is not of the expected type")
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid")
+	ErrRefreshRevoked      = errors.New("refresh token has been revoked")
+	ErrInvalidClaims       = errors.New("cannot read token claims")
+	ErrVerifyOnlyServer    = errors.New("server is not authorized to issue new tokens")
+	ErrHookAborted         = errors.New("request aborted by an event hook")
+)
+
+// reasons : the reason code of each error of the middleware, the more specific ones first
+var reasons = []struct {
+	err    error
+	reason string
+}{
+	{ErrNoAuthToken, "no_auth_token"},
+	{ErrNoCSRFToken, "no_csrf_token"},
+	{ErrCSRFMismatch, "csrf_mismatch"},
+	{ErrWrongSigningMethod, "wrong_signing_method"},
+	{ErrWrongTokenType, "wrong_token_type"},
+	{ErrTokenExpired, "token_expired"},
+	{ErrTokenInvalid, "token_invalid"},
+	{ErrRefreshRevoked, "refresh_token_revoked"},
+	{ErrRefreshTokenInvalid, "refresh_token_invalid"},
+	{ErrInvalidClaims, "invalid_claims"},
+	{ErrVerifyOnlyServer, "verify_only_server"},
+	{ErrHookAborted, "hook_aborted"},
+}
+
+// reasonOf : the reason code of one of the errors of the middleware, or ""
+func reasonOf(err error) string {
+	for _, r := range reasons {
+		if r.err == err {
+			return r.reason
+		}
+	}
+
+	return ""
+}
 
+const (
+	// reason codes of the errors that aren't one of the above
+	reasonUnauthorized  = "unauthorized"
+	reasonInternalError = "internal_error"
+)
+
+// Helper for constructing a ValidationError with a string error message
+func newJwtError(err interface{}, errType int) *Error {
 	// passthrough if this is already a pointer to a jwtErr
-	if reflect.TypeOf(err) == reflect.TypeOf(&j) {
-		return err.(*jwtError)
+	if jwtErr, ok := err.(*Error); ok {
+		return jwtErr
 	}
 
-	return &jwtError{
-		Inner: err.(error),
-		Type:  errType,
+	reason := reasonInternalError
+	if errType/100 == 4 {
+		reason = reasonUnauthorized
+	}
+	for _, r := range reasons {
+		if errors.Is(err.(error), r.err) {
+			reason = r.reason
+			break
+		}
+	}
+
+	return &Error{
+		Inner:  err.(error),
+		Type:   errType,
+		Reason: reason,
+	}
+}
+
+// newReasonError : one of the errors of the middleware, with the error that caused it, if any
+func newReasonError(reason error, cause error, errType int) *Error {
+	inner := reason
+	if cause != nil {
+		inner = fmt.Errorf("%s: %w", reason.Error(), cause)
+	}
+
+	return &Error{
+		Inner:  inner,
+		Type:   errType,
+		Reason: reasonOf(reason),
 	}
 }
 
-// A special error that tracks what http return code should be sent to client
-type jwtError struct {
-	Inner error // stores the actual error
-	Type  int   // Either a 4xx unauthorized or 5xx internal server err
+// Error : an error of the middleware, with the http status it's answered with
+type Error struct {
+	Inner  error  // stores the actual error
+	Type   int    // the http status; either a 4xx unauthorized or 5xx internal server err
+	Reason string // a reason code, e.g. "csrf_mismatch" for ErrCSRFMismatch
 }
 
-func (e jwtError) Error() string {
+func (e Error) Error() string {
 	if e.Inner != nil {
 		return e.Inner.Error()
 	}
 	return "Unknown error"
 }
+
+// Unwrap : the actual error, so errors.Is and errors.As look through it
+func (e Error) Unwrap() error {
+	return e.Inner
+}
+
+// Is : an error is one of the errors of the middleware when it has its reason code
+func (e Error) Is(target error) bool {
+	reason := reasonOf(target)
+	return reason != "" && reason == e.Reason
+}
@@ -2,7 +2,11 @@ package jwt
 
 import (
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
 )
 
 func Test_Errors(t *testing.T) {
@@ -29,3 +33,85 @@ func Test_Errors(t *testing.T) {
 		t.Errorf("[%d != %d] Error types do not match", myErr2.Type, errT)
 	}
 }
+
+func TestErrorReasons(t *testing.T) {
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString: "HS256",
+		HMACKey:             []byte("test key"),
+		BearerTokens:        true,
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+
+	w := httptest.NewRecorder()
+	if err := a.IssueNewTokens(w, &ClaimsType{}); err != nil {
+		t.Fatalf("Unable to issue tokens; Err: %v", err)
+	}
+	authTokenString := w.Header().Get(a.options.AuthTokenName)
+	refreshTokenString := w.Header().Get(a.options.RefreshTokenName)
+	csrf := w.Header().Get(a.options.CSRFTokenName)
+
+	var hs384Claims credentials
+	if err := a.buildCredentialsFromClaims(&hs384Claims, &ClaimsType{}); err != nil {
+		t.Fatalf("Unable to build credentials; Err: %v", err)
+	}
+	hs384Claims.AuthToken.Token.Claims.(*ClaimsType).Csrf = csrf
+	hs384TokenString, err := jwtGo.NewWithClaims(jwtGo.SigningMethodHS384, hs384Claims.AuthToken.Token.Claims).SignedString([]byte("test key"))
+	if err != nil {
+		t.Fatalf("Unable to sign auth token; Err: %v", err)
+	}
+
+	var reasonTests = []struct {
+		name         string
+		authToken    string
+		refreshToken string
+		csrf         string
+		expected     []error
+		reason       string
+	}{
+		{"no csrf", authTokenString, refreshTokenString, "", []error{ErrNoCSRFToken}, "no_csrf_token"},
+		{"csrf mismatch", authTokenString, refreshTokenString, "other", []error{ErrCSRFMismatch}, "csrf_mismatch"},
+		{"refresh token as auth token", refreshTokenString, "", csrf, []error{ErrTokenInvalid, ErrWrongTokenType}, "token_invalid"},
+		{"wrong signing method", hs384TokenString, "", csrf, []error{ErrTokenInvalid, ErrWrongSigningMethod}, "token_invalid"},
+	}
+
+	for _, test := range reasonTests {
+		req, reqErr := http.NewRequest("GET", "http://localhost:8080/", nil)
+		if reqErr != nil {
+			t.Fatalf("Error building request for testing; err: %v", reqErr)
+		}
+		req.Header.Set(a.options.AuthTokenName, test.authToken)
+		req.Header.Set(a.options.RefreshTokenName, test.refreshToken)
+		req.Header.Set(a.options.CSRFTokenName, test.csrf)
+
+		_, processErr := a.Process(httptest.NewRecorder(), req)
+		if processErr == nil {
+			t.Errorf("Expected an error processing the request; test: %s", test.name)
+			continue
+		}
+
+		var err error = processErr
+		for _, expected := range test.expected {
+			if !errors.Is(err, expected) {
+				t.Errorf("Expected the error to be %v; test: %s; Received: %v", expected, test.name, err)
+			}
+		}
+		var jwtErr *Error
+		if !errors.As(err, &jwtErr) || jwtErr.Type != 401 || jwtErr.Reason != test.reason {
+			t.Errorf("Expected a 401 with reason %s; test: %s; Received: %+v", test.reason, test.name, jwtErr)
+		}
+		if errors.Is(err, ErrRefreshRevoked) {
+			t.Errorf("Expected the error not to match other reasons; test: %s", test.name)
+		}
+	}
+
+	// other errors are classified by their status
+	if reason := newJwtError(errors.New("Testing Err"), 500).Reason; reason != "internal_error" {
+		t.Errorf("Unexpected reason code; Received: %s", reason)
+	}
+	if reason := newJwtError(ErrRefreshTokenNotFound, 401).Reason; reason != "unauthorized" {
+		t.Errorf("Unexpected reason code; Received: %s", reason)
+	}
+}
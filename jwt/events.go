@@ -0,0 +1,126 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// EventType : what happened to the tokens of a session
+type EventType string
+
+const (
+	// TokensIssued : new tokens were issued by IssueNewTokens
+	TokensIssued EventType = "tokens_issued"
+	// TokensRefreshed : new tokens were issued for a valid refresh token
+	TokensRefreshed EventType = "tokens_refreshed"
+	// TokensNullified : the tokens of a request were nullified by NullifyTokens
+	TokensNullified EventType = "tokens_nullified"
+	// AuthRejected : the middleware refused a request
+	AuthRejected EventType = "auth_rejected"
+	// RefreshRevokedDetected : a revoked refresh token was used; it may have been stolen
+	RefreshRevokedDetected EventType = "refresh_revoked_detected"
+)
+
+// EventRequest : the request an event happened in
+type EventRequest struct {
+	Method     string
+	Path       string
+	RemoteAddr string
+	UserAgent  string
+}
+
+// Event : a lifecycle event of the tokens of a session
+type Event struct {
+	Type EventType
+	Time time.Time
+
+	// Claims : the claims of the auth token. The claims of a rejected token may not have been
+	// verified, and are empty when the token couldn't be read.
+	Claims ClaimsType
+	// RefreshTokenId : the jti of the refresh token that was issued, used or revoked
+	RefreshTokenId string
+	// PreviousRefreshTokenId : the jti of the refresh token the tokens were refreshed with
+	PreviousRefreshTokenId string
+	// Reason : the reason code of the error a request was refused with, e.g. "csrf_mismatch"
+	Reason string
+
+	// Request : the request of the event; empty for tokens issued without one
+	Request EventRequest
+}
+
+// EventHook : called on the lifecycle events of the tokens, e.g. to write audit rows. An error
+// is logged and doesn't affect the request, unless it wraps ErrHookAborted. Then the request is
+// refused; tokens that were issued or refreshed aren't sent to the client.
+type EventHook func(ctx context.Context, event Event) error
+
+// AddEventHook : add a hook called on the lifecycle events of the tokens. Hooks are called in
+// the order they were added, on the goroutine of the request.
+func (a *Auth) AddEventHook(hook EventHook) {
+	a.eventHooks = append(a.eventHooks, hook)
+}
+
+// emit : call the hooks with the event. The error is the first one that aborts the request.
+func (a *Auth) emit(ctx context.Context, event Event) *Error {
+	event.Time = time.Now()
+
+	var aborted *Error
+	for _, hook := range a.eventHooks {
+		err := runEventHook(ctx, hook, event)
+		if err == nil {
+			continue
+		}
+
+		if errors.Is(err, ErrHookAborted) {
+			a.log().Warn("event hook aborted the request", "event", string(event.Type), "error", err.Error())
+			if aborted == nil {
+				aborted = newJwtError(err, 401)
+			}
+			continue
+		}
+		a.log().Error("event hook failed", "event", string(event.Type), "error", err.Error())
+	}
+
+	return aborted
+}
+
+// runEventHook : call the hook, turning a panic into an error
+func runEventHook(ctx context.Context, hook EventHook, event Event) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("event hook panicked: %v", recovered)
+		}
+	}()
+
+	return hook(ctx, event)
+}
+
+// credentialsEvent : an event about the tokens of the credentials
+func credentialsEvent(eventType EventType, c *credentials, r *http.Request) Event {
+	event := Event{Type: eventType}
+	if c != nil {
+		if c.AuthToken != nil && c.AuthToken.Token != nil {
+			if claims, ok := c.AuthToken.Token.Claims.(*ClaimsType); ok {
+				event.Claims = *claims
+			}
+		}
+		if c.RefreshToken != nil && c.RefreshToken.Token != nil {
+			if claims, ok := c.RefreshToken.Token.Claims.(*ClaimsType); ok {
+				event.RefreshTokenId = claims.ID
+			}
+		}
+		event.PreviousRefreshTokenId = c.previousRefreshTokenId
+	}
+	if r != nil {
+		event.Request = EventRequest{
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			RemoteAddr: r.RemoteAddr,
+			UserAgent:  r.UserAgent(),
+		}
+	}
+
+	return event
+}
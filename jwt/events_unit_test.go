@@ -0,0 +1,217 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
+)
+
+func TestEventHooks(t *testing.T) {
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString: "HS256",
+		HMACKey:             []byte("test key"),
+		BearerTokens:        true,
+		UpdateTokenClaims:   func(claims *ClaimsType) ClaimsType { return *claims },
+		// the failing hooks below are logged
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+
+	var events []Event
+	a.AddEventHook(func(ctx context.Context, event Event) error {
+		events = append(events, event)
+		return nil
+	})
+	// failing hooks don't affect the requests
+	a.AddEventHook(func(ctx context.Context, event Event) error {
+		return errors.New("audit database is down")
+	})
+	a.AddEventHook(func(ctx context.Context, event Event) error {
+		panic("hook bug")
+	})
+
+	w := httptest.NewRecorder()
+	if err := a.IssueNewTokens(w, &ClaimsType{UID: "user id"}); err != nil {
+		t.Fatalf("Unable to issue tokens; Err: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != TokensIssued || events[0].Claims.UID != "user id" || events[0].RefreshTokenId == "" {
+		t.Fatalf("Expected a TokensIssued event; Received: %+v", events)
+	}
+	refreshTokenId := events[0].RefreshTokenId
+
+	csrf := w.Header().Get(a.options.CSRFTokenName)
+	expiredClaims := ClaimsType{UID: "user id", Csrf: csrf, TokenUse: tokenUseAccess}
+	expiredClaims.ExpiresAt = jwtGo.NewNumericDate(time.Now().Add(-time.Minute))
+	expiredAuthTokenString, err := a.encodeToken(newAuthTokenWithClaims(jwtGo.SigningMethodHS256, &expiredClaims))
+	if err != nil {
+		t.Fatalf("Unable to sign auth token; Err: %v", err)
+	}
+
+	newRequest := func(authTokenString string, csrf string) *http.Request {
+		req, reqErr := http.NewRequest("GET", "http://localhost:8080/restricted", nil)
+		if reqErr != nil {
+			t.Fatalf("Error building request for testing; err: %v", reqErr)
+		}
+		req.Header.Set(a.options.AuthTokenName, authTokenString)
+		req.Header.Set(a.options.RefreshTokenName, w.Header().Get(a.options.RefreshTokenName))
+		req.Header.Set(a.options.CSRFTokenName, csrf)
+		return req
+	}
+	handler := a.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var tests = []struct {
+		name             string
+		authToken        string
+		csrf             string
+		checkTokenId     TokenIdChecker
+		expectedStatus   int
+		expectedEvents   []EventType
+		expectedReason   string
+		expectedPrevious string
+	}{
+		{"refresh", expiredAuthTokenString, csrf, defaultCheckTokenId, http.StatusOK, []EventType{TokensRefreshed}, "", refreshTokenId},
+		{"csrf mismatch", w.Header().Get(a.options.AuthTokenName), "wrong csrf string", defaultCheckTokenId, http.StatusUnauthorized, []EventType{AuthRejected}, "csrf_mismatch", ""},
+		{"revoked", expiredAuthTokenString, csrf, func(*ClaimsType) bool { return false }, http.StatusUnauthorized, []EventType{RefreshRevokedDetected, AuthRejected}, "refresh_token_revoked", ""},
+	}
+
+	for _, test := range tests {
+		events = nil
+		a.SetCheckTokenIdFunction(test.checkTokenId)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newRequest(test.authToken, test.csrf))
+		if rec.Code != test.expectedStatus {
+			t.Errorf("[%s] Expected status %d; Received: %d", test.name, test.expectedStatus, rec.Code)
+		}
+
+		if len(events) != len(test.expectedEvents) {
+			t.Fatalf("[%s] Expected events %v; Received: %+v", test.name, test.expectedEvents, events)
+		}
+		for i, eventType := range test.expectedEvents {
+			if events[i].Type != eventType {
+				t.Errorf("[%s] Expected event %s; Received: %s", test.name, eventType, events[i].Type)
+			}
+		}
+
+		last := events[len(events)-1]
+		if last.Reason != test.expectedReason || last.PreviousRefreshTokenId != test.expectedPrevious {
+			t.Errorf("[%s] Unexpected event; Received: %+v", test.name, last)
+		}
+		if last.Claims.UID != "user id" || last.Request.Method != "GET" || last.Request.Path != "/restricted" {
+			t.Errorf("[%s] Expected the claims and the request of the event; Received: %+v", test.name, last)
+		}
+		if test.expectedPrevious != "" && (last.RefreshTokenId == "" || last.RefreshTokenId == test.expectedPrevious) {
+			t.Errorf("[%s] Expected the id of the new refresh token; Received: %s", test.name, last.RefreshTokenId)
+		}
+	}
+	a.SetCheckTokenIdFunction(defaultCheckTokenId)
+
+	events = nil
+	if err := a.NullifyTokens(httptest.NewRecorder(), newRequest(w.Header().Get(a.options.AuthTokenName), csrf)); err != nil {
+		t.Errorf("Unable to nullify tokens; Err: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != TokensNullified || events[0].RefreshTokenId != refreshTokenId {
+		t.Errorf("Expected a TokensNullified event; Received: %+v", events)
+	}
+
+	// a hook can refuse the tokens
+	a.AddEventHook(func(ctx context.Context, event Event) error {
+		if event.Type == TokensRefreshed || event.Type == TokensIssued {
+			return fmt.Errorf("user is disabled: %w", ErrHookAborted)
+		}
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest(expiredAuthTokenString, csrf))
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get(a.options.AuthTokenName) != "" {
+		t.Errorf("Expected the refreshed tokens to be refused; Received: %d, %q", rec.Code, rec.Header().Get(a.options.AuthTokenName))
+	}
+	if last := events[len(events)-1]; last.Type != AuthRejected || last.Reason != "hook_aborted" {
+		t.Errorf("Expected the request to be rejected by the hook; Received: %+v", last)
+	}
+
+	rec = httptest.NewRecorder()
+	if err := a.IssueNewTokens(rec, &ClaimsType{}); !errors.Is(err, ErrHookAborted) || rec.Header().Get(a.options.AuthTokenName) != "" {
+		t.Errorf("Expected no tokens to be issued; Err: %v", err)
+	}
+}
+
+func TestEventHooksOpaqueRefreshToken(t *testing.T) {
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString: "HS256",
+		HMACKey:             []byte("test key"),
+		RefreshTokenStore:   NewMemoryRefreshTokenStore(),
+		BearerTokens:        true,
+		UpdateTokenClaims:   func(claims *ClaimsType) ClaimsType { return *claims },
+		Logger:              slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+
+	var events []Event
+	a.AddEventHook(func(ctx context.Context, event Event) error {
+		events = append(events, event)
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	if err := a.IssueNewTokens(w, &ClaimsType{UID: "user id"}); err != nil {
+		t.Fatalf("Unable to issue tokens; Err: %v", err)
+	}
+	refreshTokenId := events[0].RefreshTokenId
+
+	csrf := w.Header().Get(a.options.CSRFTokenName)
+	expiredClaims := ClaimsType{UID: "user id", Csrf: csrf, TokenUse: tokenUseAccess}
+	expiredClaims.ExpiresAt = jwtGo.NewNumericDate(time.Now().Add(-time.Minute))
+	expiredAuthTokenString, err := a.encodeToken(newAuthTokenWithClaims(jwtGo.SigningMethodHS256, &expiredClaims))
+	if err != nil {
+		t.Fatalf("Unable to sign auth token; Err: %v", err)
+	}
+
+	newRequest := func() *http.Request {
+		req, reqErr := http.NewRequest("GET", "http://localhost:8080/restricted", nil)
+		if reqErr != nil {
+			t.Fatalf("Error building request for testing; err: %v", reqErr)
+		}
+		req.Header.Set(a.options.AuthTokenName, expiredAuthTokenString)
+		req.Header.Set(a.options.RefreshTokenName, w.Header().Get(a.options.RefreshTokenName))
+		req.Header.Set(a.options.CSRFTokenName, csrf)
+		return req
+	}
+	handler := a.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// the refresh token is used once
+	events = nil
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest())
+	if rec.Code != http.StatusOK || len(events) != 1 || events[0].Type != TokensRefreshed {
+		t.Fatalf("Expected the tokens to be refreshed; Received: %d, %+v", rec.Code, events)
+	}
+
+	// and replaying it is reported
+	events = nil
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest())
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the replayed refresh token to be refused; Received: %d", rec.Code)
+	}
+	if len(events) != 2 || events[0].Type != RefreshRevokedDetected || events[1].Type != AuthRejected || events[1].Reason != "refresh_token_revoked" {
+		t.Fatalf("Expected RefreshRevokedDetected and AuthRejected events; Received: %+v", events)
+	}
+	if detected := events[0]; detected.RefreshTokenId != refreshTokenId || detected.Claims.UID != "user id" || detected.Request.Path != "/restricted" {
+		t.Errorf("Expected the replayed token and the request of the event; Received: %+v", detected)
+	}
+}
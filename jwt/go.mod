@@ -1,8 +1,20 @@
 module github.com/Lioric/jwt-auth/jwt
 
-go 1.14
+go 1.21
 
 require (
-	github.com/adam-hanna/randomstrings v0.0.0-20160715001758-88fd7c52a2c7	
+	github.com/adam-hanna/randomstrings v0.0.0-20160715001758-88fd7c52a2c7
 	github.com/golang-jwt/jwt/v5 v5.2.1
+	go.opentelemetry.io/otel v1.29.0
+	go.opentelemetry.io/otel/sdk v1.29.0
+	go.opentelemetry.io/otel/trace v1.29.0
+	golang.org/x/crypto v0.14.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	go.opentelemetry.io/otel/metric v1.29.0 // indirect
+	golang.org/x/sys v0.24.0 // indirect
 )
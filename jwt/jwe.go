@@ -0,0 +1,180 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+const (
+	// content encryption of every encrypted token, https://tools.ietf.org/html/rfc7518#section-5.3
+	jweContentEncryption = "A256GCM"
+	jweContentKeySize    = 32
+)
+
+// errTokenDecryption : the same error for every decryption failure, so they can't be told apart
+var errTokenDecryption = errors.New("unable to decrypt token")
+
+// tokenEncryption : wraps signed tokens in a JWE (https://tools.ietf.org/html/rfc7516), so their
+// claims can only be read by servers holding the decryption key
+type tokenEncryption struct {
+	alg string
+
+	// dir
+	key []byte
+
+	// RSA-OAEP-256
+	decrypter crypto.Decrypter
+	publicKey *rsa.PublicKey
+}
+
+type jweHeader struct {
+	Alg string `json:"alg"`
+	Enc string `json:"enc"`
+	Cty string `json:"cty,omitempty"`
+	Zip string `json:"zip,omitempty"`
+}
+
+func newTokenEncryption(o *Options) (*tokenEncryption, error) {
+	switch o.TokenEncryption {
+	case "dir":
+		if len(o.TokenEncryptionKey) != jweContentKeySize {
+			return nil, errors.New("dir token encryption requires a 32 byte TokenEncryptionKey")
+		}
+		if o.TokenDecryptionKey != nil {
+			return nil, errors.New("dir token encryption uses TokenEncryptionKey, not TokenDecryptionKey")
+		}
+
+		return &tokenEncryption{alg: o.TokenEncryption, key: o.TokenEncryptionKey}, nil
+
+	case "RSA-OAEP-256":
+		if o.TokenDecryptionKey == nil {
+			return nil, errors.New("RSA-OAEP-256 token encryption requires a TokenDecryptionKey")
+		}
+		if len(o.TokenEncryptionKey) > 0 {
+			return nil, errors.New("RSA-OAEP-256 token encryption uses TokenDecryptionKey, not TokenEncryptionKey")
+		}
+		publicKey, ok := o.TokenDecryptionKey.Public().(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("RSA-OAEP-256 token encryption requires an RSA TokenDecryptionKey")
+		}
+
+		return &tokenEncryption{alg: o.TokenEncryption, decrypter: o.TokenDecryptionKey, publicKey: publicKey}, nil
+	}
+
+	return nil, errors.New("token encryption not recognized, use \"dir\" or \"RSA-OAEP-256\"")
+}
+
+// encrypt : the JWE compact serialization of a signed token
+func (e *tokenEncryption) encrypt(tokenString string) (string, error) {
+	header, err := json.Marshal(jweHeader{Alg: e.alg, Enc: jweContentEncryption, Cty: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	encodedHeader := base64.RawURLEncoding.EncodeToString(header)
+
+	var contentKey, encryptedKey []byte
+	if e.alg == "dir" {
+		contentKey = e.key
+	} else {
+		contentKey = make([]byte, jweContentKeySize)
+		if _, err := rand.Read(contentKey); err != nil {
+			return "", err
+		}
+		encryptedKey, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, e.publicKey, contentKey, nil)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	gcm, err := newGCM(contentKey)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+
+	// the encoded header is the additional authenticated data
+	sealed := gcm.Seal(nil, iv, []byte(tokenString), []byte(encodedHeader))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	return strings.Join([]string{
+		encodedHeader,
+		base64.RawURLEncoding.EncodeToString(encryptedKey),
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, "."), nil
+}
+
+// decrypt : the signed token inside a JWE compact serialization
+func (e *tokenEncryption) decrypt(jweString string) (string, error) {
+	parts := strings.Split(jweString, ".")
+	if len(parts) != 5 {
+		return "", errors.New("token is not encrypted")
+	}
+
+	var decoded [5][]byte
+	for i, part := range parts {
+		var err error
+		decoded[i], err = base64.RawURLEncoding.DecodeString(part)
+		if err != nil {
+			return "", errTokenDecryption
+		}
+	}
+
+	var header jweHeader
+	if err := json.Unmarshal(decoded[0], &header); err != nil {
+		return "", errTokenDecryption
+	}
+	if header.Alg != e.alg || header.Enc != jweContentEncryption || header.Zip != "" {
+		return "", errors.New("unexpected token encryption")
+	}
+
+	var contentKey []byte
+	if e.alg == "dir" {
+		if len(decoded[1]) != 0 {
+			return "", errTokenDecryption
+		}
+		contentKey = e.key
+	} else {
+		var err error
+		contentKey, err = e.decrypter.Decrypt(rand.Reader, decoded[1], &rsa.OAEPOptions{Hash: crypto.SHA256})
+		if err != nil || len(contentKey) != jweContentKeySize {
+			return "", errTokenDecryption
+		}
+	}
+
+	gcm, err := newGCM(contentKey)
+	if err != nil {
+		return "", err
+	}
+	if len(decoded[2]) != gcm.NonceSize() || len(decoded[4]) != gcm.Overhead() {
+		return "", errTokenDecryption
+	}
+
+	plaintext, err := gcm.Open(nil, decoded[2], append(decoded[3], decoded[4]...), []byte(parts[0]))
+	if err != nil {
+		return "", errTokenDecryption
+	}
+
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
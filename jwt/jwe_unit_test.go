@@ -0,0 +1,158 @@
+package jwt
+
+import (
+	"crypto/rsa"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
+)
+
+func TestTokenEncryption(t *testing.T) {
+	signBytes, err := ioutil.ReadFile("test/priv.rsa")
+	if err != nil {
+		t.Fatalf("Unable to read RSA private key file: %v", err)
+	}
+	rsaKey, err := jwtGo.ParseRSAPrivateKeyFromPEM(signBytes)
+	if err != nil {
+		t.Fatalf("Unable to parse RSA private key: %v", err)
+	}
+	verifyBytes, err := ioutil.ReadFile("test/priv.rsa.pub")
+	if err != nil {
+		t.Fatalf("Unable to read RSA public key file: %v", err)
+	}
+	contentKey := []byte("0123456789abcdef0123456789abcdef")
+
+	var encryptionTests = []struct {
+		name          string
+		encryption    string
+		encryptionKey []byte
+		decryptionKey *rsa.PrivateKey
+	}{
+		{"dir", "dir", contentKey, nil},
+		{"RSA-OAEP-256", "RSA-OAEP-256", nil, rsaKey},
+	}
+
+	for _, test := range encryptionTests {
+		options := Options{
+			SigningMethodString: "RS256",
+			PrivateKeyLocation:  "test/priv.rsa",
+			PublicKeyLocation:   "test/priv.rsa.pub",
+			TokenEncryption:     test.encryption,
+			TokenEncryptionKey:  test.encryptionKey,
+			IsDevEnv:            true,
+		}
+		if test.decryptionKey != nil {
+			options.TokenDecryptionKey = test.decryptionKey
+		}
+
+		var a Auth
+		if err := New(&a, options); err != nil {
+			t.Fatalf("Unable to build jwt auth for testing; test: %s; Err: %v", test.name, err)
+		}
+
+		claims := ClaimsType{CustomClaims: map[string]interface{}{"tenant": "secret-tenant-id"}}
+		w := httptest.NewRecorder()
+		if err := a.IssueNewTokens(w, &claims); err != nil {
+			t.Fatalf("Unable to issue tokens; test: %s; Err: %v", test.name, err)
+		}
+
+		req, reqErr := http.NewRequest("GET", "http://localhost:8080/", nil)
+		if reqErr != nil {
+			t.Fatalf("Error building request for testing; err: %v", reqErr)
+		}
+		var authTokenString string
+		for _, cookie := range w.Result().Cookies() {
+			req.AddCookie(cookie)
+			if cookie.Name == a.options.AuthTokenName {
+				authTokenString = cookie.Value
+			}
+		}
+		req.Header.Add(a.options.CSRFTokenName, w.Header().Get(a.options.CSRFTokenName))
+
+		// the claims can't be read by the client
+		if strings.Count(authTokenString, ".") != 4 {
+			t.Errorf("Expected a JWE compact token; test: %s; Received: %s", test.name, authTokenString)
+		}
+		if _, _, err := jwtGo.NewParser().ParseUnverified(authTokenString, &ClaimsType{}); err == nil {
+			t.Errorf("Expected the encrypted token to not be readable as a jwt; test: %s", test.name)
+		}
+
+		rec := httptest.NewRecorder()
+		a.Handler(myHandlerFunc).ServeHTTP(rec, req)
+		if rec.Code != 200 || rec.Body.String() != "In Handler Func" {
+			t.Errorf("Expected encrypted tokens to be accepted; test: %s; Received: %d %s", test.name, rec.Code, rec.Body.String())
+		}
+
+		// verify only servers decrypt with the same key, without the signing key
+		var v Auth
+		verifyOptions := options
+		verifyOptions.VerifyOnlyServer = true
+		verifyOptions.PrivateKeyLocation = ""
+		verifyOptions.PublicKeyLocation = ""
+		verifyOptions.PublicKeyPEM = verifyBytes
+		if err := New(&v, verifyOptions); err != nil {
+			t.Fatalf("Unable to build jwt auth for testing; test: %s; Err: %v", test.name, err)
+		}
+		var c credentials
+		if err := v.buildCredentialsFromStrings("", authTokenString, "", &c); err != nil {
+			t.Errorf("Unable to build credentials; test: %s; Err: %v", test.name, err)
+		}
+		if c.AuthToken.ParseErr != nil {
+			t.Errorf("Expected a verify only server to decrypt the token; test: %s; Err: %v", test.name, c.AuthToken.ParseErr)
+		}
+		if c.AuthToken.Token.Claims.(*ClaimsType).CustomClaims["tenant"] != "secret-tenant-id" {
+			t.Errorf("Expected the custom claims to survive encryption; test: %s", test.name)
+		}
+
+		// a modified ciphertext is refused
+		parts := strings.Split(authTokenString, ".")
+		parts[3] = strings.Map(func(r rune) rune {
+			if r == 'A' {
+				return 'B'
+			}
+			return 'A'
+		}, parts[3][:1]) + parts[3][1:]
+		if err := v.buildCredentialsFromStrings("", strings.Join(parts, "."), "", &c); err != nil {
+			t.Errorf("Unable to build credentials; test: %s; Err: %v", test.name, err)
+		}
+		if c.AuthToken.ParseErr == nil {
+			t.Errorf("Expected a modified token to be refused; test: %s", test.name)
+		}
+
+		// and so are signed tokens that were never encrypted
+		var plain credentials
+		if err := a.buildCredentialsFromClaims(&plain, &claims); err != nil {
+			t.Errorf("Unable to build credentials; test: %s; Err: %v", test.name, err)
+		}
+		signedString, signErr := a.signToken(plain.AuthToken.Token)
+		if signErr != nil {
+			t.Fatalf("Unable to sign auth token; Err: %v", signErr)
+		}
+		if err := a.buildCredentialsFromStrings(plain.CsrfString, signedString, "", &c); err != nil {
+			t.Errorf("Unable to build credentials; test: %s; Err: %v", test.name, err)
+		}
+		if c.AuthToken.ParseErr == nil {
+			t.Errorf("Expected an unencrypted token to be refused; test: %s", test.name)
+		}
+	}
+
+	var optionTests = []struct {
+		name    string
+		options Options
+	}{
+		{"short key", Options{SigningMethodString: "HS256", HMACKey: []byte("test key"), TokenEncryption: "dir", TokenEncryptionKey: []byte("short")}},
+		{"missing decryption key", Options{SigningMethodString: "HS256", HMACKey: []byte("test key"), TokenEncryption: "RSA-OAEP-256"}},
+		{"unknown encryption", Options{SigningMethodString: "HS256", HMACKey: []byte("test key"), TokenEncryption: "A256KW", TokenEncryptionKey: contentKey}},
+		{"key without encryption", Options{SigningMethodString: "HS256", HMACKey: []byte("test key"), TokenEncryptionKey: contentKey}},
+	}
+	for _, test := range optionTests {
+		var a Auth
+		if err := New(&a, test.options); err == nil {
+			t.Errorf("Expected an error building jwt auth; test: %s", test.name)
+		}
+	}
+}
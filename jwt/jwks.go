@@ -0,0 +1,268 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"strconv"
+)
+
+// JSONWebKey : a public key in RFC 7517 JSON Web Key format
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+
+	// RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC and OKP keys
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+
+	// keys given as a certificate chain
+	X5c     []string `json:"x5c,omitempty"`
+	X5tS256 string   `json:"x5t#S256,omitempty"`
+}
+
+// JSONWebKeySet : a set of JSON Web Keys, as served from a jwks endpoint
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS : the keys currently trusted for verification, as a JSON Web Key Set.
+// Symmetric (HMAC) keys are secret and are never published.
+func (a *Auth) JWKS() (JSONWebKeySet, error) {
+	if isHMACSigningMethod(a.options.SigningMethodString) {
+		return JSONWebKeySet{}, errors.New("cannot publish the keys of an HMAC signing method")
+	}
+
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, entry := range a.keys.verifyEntries() {
+		jwk, err := newJSONWebKey(entry.kid, a.options.SigningMethodString, entry.verifyKey)
+		if err != nil {
+			return JSONWebKeySet{}, err
+		}
+		if len(entry.certificates) > 0 {
+			jwk.X5c = encodeCertificateChain(entry.certificates)
+			jwk.X5tS256 = certificateThumbprint(entry.certificates[0])
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set, nil
+}
+
+// JWKSHandler : an http.Handler that serves the keys currently trusted for verification
+// as a JSON Web Key Set, e.g. at /.well-known/jwks.json. Verify only servers can use it
+// in place of a copy of the public key file.
+func (a *Auth) JWKSHandler() (http.Handler, error) {
+	if isHMACSigningMethod(a.options.SigningMethodString) {
+		return nil, errors.New("cannot publish the keys of an HMAC signing method")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		set, err := a.JWKS()
+		if err != nil {
+			a.log().Error("jwks cannot be built", "error", err.Error())
+			a.errorHandler.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := json.Marshal(set)
+		if err != nil {
+			a.log().Error("jwks cannot be encoded", "error", err.Error())
+			a.errorHandler.ServeHTTP(w, r)
+			return
+		}
+
+		sum := sha256.Sum256(body)
+		etag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age="+strconv.FormatInt(int64(a.options.JWKSMaxAge.Seconds()), 10))
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		if r.Method == "GET" {
+			_, _ = w.Write(body)
+		}
+	}), nil
+}
+
+func isHMACSigningMethod(signingMethodString string) bool {
+	return signingMethodString == "HS256" || signingMethodString == "HS384" || signingMethodString == "HS512"
+}
+
+func isPublicKeySigningMethod(signingMethodString string) bool {
+	switch signingMethodString {
+	case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA":
+		return true
+	}
+
+	return false
+}
+
+func newJSONWebKey(kid string, alg string, key interface{}) (JSONWebKey, error) {
+	jwk := JSONWebKey{
+		Kid: kid,
+		Alg: alg,
+		Use: "sig",
+	}
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+
+	case *ecdsa.PublicKey:
+		crv, err := curveName(k.Curve)
+		if err != nil {
+			return JSONWebKey{}, err
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = crv
+		jwk.X = base64.RawURLEncoding.EncodeToString(k.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(k.Y.FillBytes(make([]byte, size)))
+
+	case ed25519.PublicKey:
+		// https://tools.ietf.org/html/rfc8037#section-2
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(k)
+
+	default:
+		return JSONWebKey{}, errors.New("unsupported key type for a json web key")
+	}
+
+	return jwk, nil
+}
+
+// publicKey : the public key described by the jwk
+func (k JSONWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid rsa json web key")
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.New("unsupported elliptic curve")
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		key := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("invalid ec json web key")
+		}
+
+		return key, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, errors.New("unsupported octet key pair curve")
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid okp json web key")
+		}
+
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, errors.New("unsupported json web key type")
+}
+
+func curveName(curve elliptic.Curve) (string, error) {
+	switch curve {
+	case elliptic.P256():
+		return "P-256", nil
+	case elliptic.P384():
+		return "P-384", nil
+	case elliptic.P521():
+		return "P-521", nil
+	}
+
+	return "", errors.New("unsupported elliptic curve")
+}
+
+// jwkThumbprint : the RFC 7638 thumbprint of a public key, used as its default kid
+func jwkThumbprint(key interface{}) (string, error) {
+	jwk, err := newJSONWebKey("", "", key)
+	if err != nil {
+		return "", err
+	}
+
+	// the required members, in lexicographic order and without whitespace
+	var members string
+	switch jwk.Kty {
+	case "RSA":
+		members = `{"e":"` + jwk.E + `","kty":"RSA","n":"` + jwk.N + `"}`
+	case "EC":
+		members = `{"crv":"` + jwk.Crv + `","kty":"EC","x":"` + jwk.X + `","y":"` + jwk.Y + `"}`
+	case "OKP":
+		members = `{"crv":"` + jwk.Crv + `","kty":"OKP","x":"` + jwk.X + `"}`
+	}
+
+	sum := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,221 @@
+package jwt
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	defaultJWKSCacheTTL           = 15 * time.Minute
+	defaultJWKSMinRefreshInterval = 1 * time.Minute
+	defaultJWKSFetchTimeout       = 10 * time.Second
+
+	// a jwks larger than this is almost certainly not a jwks
+	maxJWKSResponseBytes = 1 << 20
+)
+
+// remoteKeySet : verification keys fetched from the jwks endpoint of the issuing server
+type remoteKeySet struct {
+	url                 string
+	client              *http.Client
+	ttl                 time.Duration
+	minRefreshInterval  time.Duration
+	signingMethodString string
+	acceptedAlgs        []string
+	logger              *slog.Logger
+
+	// guards keys and fetchedAt
+	mu        sync.RWMutex
+	keys      map[string]interface{}
+	fetchedAt time.Time
+
+	// guards the fields below. It's never held during a fetch, so a slow issuer doesn't hold
+	// up requests served from the cache.
+	fetchMu     sync.Mutex
+	lastAttempt time.Time
+	inflight    *jwksFetch
+
+	// whether a background refresh is running
+	refreshing atomic.Bool
+}
+
+// jwksFetch : a fetch of the jwks, shared by every caller that asks for one while it runs
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+func newRemoteKeySet(o *Options, logger *slog.Logger) *remoteKeySet {
+	client := o.JWKSHTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: defaultJWKSFetchTimeout}
+	}
+
+	return &remoteKeySet{
+		url:                 o.JWKSURL,
+		client:              client,
+		ttl:                 o.JWKSCacheTTL,
+		minRefreshInterval:  o.JWKSMinRefreshInterval,
+		signingMethodString: o.SigningMethodString,
+		acceptedAlgs:        append([]string{o.SigningMethodString}, o.AcceptSigningMethods...),
+		logger:              logger,
+	}
+}
+
+func (s *remoteKeySet) verifyKeyForToken(token *jwtGo.Token) (interface{}, error) {
+	var kid string
+	if headerKid, ok := token.Header["kid"]; ok {
+		kid, ok = headerKid.(string)
+		if !ok {
+			return nil, errors.New("kid in token header is not a string")
+		}
+	}
+
+	key, fresh, found := s.lookup(kid)
+	if found {
+		if !fresh {
+			// keep serving the cached keys while they are refreshed in the background
+			s.refreshInBackground()
+		}
+		return key, nil
+	}
+
+	// an unknown kid usually means the issuer has rotated its keys
+	if err := s.refresh(); err != nil {
+		s.logger.Warn("jwks cannot be refreshed", "url", s.url, "error", err.Error())
+	}
+
+	key, _, found = s.lookup(kid)
+	if !found {
+		return nil, errors.New("no verify key found for the kid in the token header")
+	}
+
+	return key, nil
+}
+
+func (s *remoteKeySet) lookup(kid string) (key interface{}, fresh bool, found bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	fresh = time.Since(s.fetchedAt) < s.ttl
+	if kid == "" && len(s.keys) == 1 {
+		// tokens without a kid can only be matched when there is no ambiguity
+		for _, key = range s.keys {
+			return key, fresh, true
+		}
+	}
+
+	key, found = s.keys[kid]
+	return key, fresh, found
+}
+
+func (s *remoteKeySet) refreshInBackground() {
+	if !s.refreshing.CompareAndSwap(false, true) {
+		return
+	}
+
+	go func() {
+		defer s.refreshing.Store(false)
+
+		if err := s.refresh(); err != nil {
+			s.logger.Warn("jwks cannot be refreshed", "url", s.url, "error", err.Error())
+		}
+	}()
+}
+
+// refresh : fetch the jwks, unless it was fetched too recently. A fetch that is already
+// running is waited for instead of starting another one. On failure the last good key set
+// is kept.
+func (s *remoteKeySet) refresh() error {
+	s.fetchMu.Lock()
+	if f := s.inflight; f != nil {
+		s.fetchMu.Unlock()
+		<-f.done
+		return f.err
+	}
+	if !s.lastAttempt.IsZero() && time.Since(s.lastAttempt) < s.minRefreshInterval {
+		s.fetchMu.Unlock()
+		return nil
+	}
+	s.lastAttempt = time.Now()
+	f := &jwksFetch{done: make(chan struct{})}
+	s.inflight = f
+	s.fetchMu.Unlock()
+
+	keys, err := s.fetch()
+	if err == nil {
+		s.mu.Lock()
+		s.keys = keys
+		s.fetchedAt = time.Now()
+		s.mu.Unlock()
+	}
+
+	f.err = err
+	s.fetchMu.Lock()
+	s.inflight = nil
+	s.fetchMu.Unlock()
+	close(f.done)
+
+	return err
+}
+
+func (s *remoteKeySet) fetch() (map[string]interface{}, error) {
+	resp, err := s.client.Get(s.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("unexpected status code from jwks url: " + strconv.Itoa(resp.StatusCode))
+	}
+
+	var set JSONWebKeySet
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSResponseBytes)).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]interface{})
+	for _, jwk := range set.Keys {
+		// skip keys that aren't meant for verifying tokens with our signing method
+		if (jwk.Use != "" && jwk.Use != "sig") || (jwk.Alg != "" && !s.acceptsAlg(jwk.Alg)) {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			s.logger.Warn("jwk skipped", "kid", jwk.Kid, "error", err.Error())
+			continue
+		}
+		if err := checkKeyTypes(s.signingMethodString, nil, key); err != nil {
+			continue
+		}
+
+		keys[jwk.Kid] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("jwks contains no usable keys")
+	}
+
+	return keys, nil
+}
+
+func (s *remoteKeySet) acceptsAlg(alg string) bool {
+	for _, accepted := range s.acceptedAlgs {
+		if alg == accepted {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,250 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRemoteJWKS(t *testing.T) {
+	var issuer Auth
+	authErr := New(&issuer, Options{
+		SigningMethodString: "ES256",
+		PrivateKeyLocation:  "test/ecdsa_256_priv.pem",
+		PublicKeyLocation:   "test/ecdsa_256_pub.pem",
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+
+	handler, err := issuer.JWKSHandler()
+	if err != nil {
+		t.Fatalf("Unable to build jwks handler; Err: %v", err)
+	}
+
+	var fetches int32
+	var failing int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	var verifier Auth
+	authErr = New(&verifier, Options{
+		SigningMethodString:    "ES256",
+		VerifyOnlyServer:       true,
+		JWKSURL:                ts.URL,
+		JWKSMinRefreshInterval: 50 * time.Millisecond,
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build verify only jwt auth for testing; Err: %v", authErr)
+	}
+
+	issueToken := func() (string, string) {
+		var c credentials
+		var claims ClaimsType
+		if err := issuer.buildCredentialsFromClaims(&c, &claims); err != nil {
+			t.Errorf("Unable to build credentials; Err: %v", err)
+		}
+		tokenString, err := issuer.signToken(c.AuthToken.Token)
+		if err != nil {
+			t.Errorf("Unable to sign auth token; Err: %v", err)
+		}
+		return c.CsrfString, tokenString
+	}
+	verifyToken := func(csrf string, tokenString string) error {
+		var c credentials
+		if err := verifier.buildCredentialsFromStrings(csrf, tokenString, "", &c); err != nil {
+			return err
+		}
+		return c.AuthToken.ParseErr
+	}
+
+	csrf, tokenString := issueToken()
+	if err := verifyToken(csrf, tokenString); err != nil {
+		t.Errorf("Expected token to verify with the fetched jwks; Err: %v", err)
+	}
+	if atomic.LoadInt32(&fetches) != 1 {
+		t.Errorf("Incorrect number of jwks fetches; Expected: %d; Received: %d", 1, atomic.LoadInt32(&fetches))
+	}
+
+	// the cached key set is used while it's fresh
+	if err := verifyToken(csrf, tokenString); err != nil {
+		t.Errorf("Expected token to verify with the cached jwks; Err: %v", err)
+	}
+	if atomic.LoadInt32(&fetches) != 1 {
+		t.Errorf("Incorrect number of jwks fetches; Expected: %d; Received: %d", 1, atomic.LoadInt32(&fetches))
+	}
+
+	// a rotated key on the issuer is picked up by its unknown kid
+	rotatedKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key; Err: %v", err)
+	}
+	if err := issuer.AddKey("rotated", rotatedKey, &rotatedKey.PublicKey); err != nil {
+		t.Errorf("Unable to add key; Err: %v", err)
+	}
+	if err := issuer.PromoteKey("rotated"); err != nil {
+		t.Errorf("Unable to promote key; Err: %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	csrf, rotatedTokenString := issueToken()
+	if err := verifyToken(csrf, rotatedTokenString); err != nil {
+		t.Errorf("Expected token signed with a rotated key to verify; Err: %v", err)
+	}
+	if atomic.LoadInt32(&fetches) != 2 {
+		t.Errorf("Incorrect number of jwks fetches; Expected: %d; Received: %d", 2, atomic.LoadInt32(&fetches))
+	}
+
+	// unknown kids can't be used to hammer the issuer
+	unknownKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key; Err: %v", err)
+	}
+	if err := issuer.AddKey("unknown", unknownKey, &unknownKey.PublicKey); err != nil {
+		t.Errorf("Unable to add key; Err: %v", err)
+	}
+	if err := issuer.PromoteKey("unknown"); err != nil {
+		t.Errorf("Unable to promote key; Err: %v", err)
+	}
+	if err := issuer.RemoveKey("rotated"); err != nil {
+		t.Errorf("Unable to remove key; Err: %v", err)
+	}
+	if err := issuer.RemoveKey("unknown"); err == nil {
+		t.Error("Expected an error when removing the active key")
+	}
+
+	csrf, unknownTokenString := issueToken()
+	for i := 0; i < 5; i++ {
+		if err := verifyToken(csrf, unknownTokenString); err == nil {
+			t.Error("Expected token with a kid that was never fetched to fail verification")
+		}
+	}
+	if atomic.LoadInt32(&fetches) != 2 {
+		t.Errorf("Expected refreshes to be rate limited; Expected: %d; Received: %d", 2, atomic.LoadInt32(&fetches))
+	}
+
+	// the last good key set is kept while the issuer is unavailable
+	atomic.StoreInt32(&failing, 1)
+	time.Sleep(60 * time.Millisecond)
+	if err := verifyToken(csrf, unknownTokenString); err == nil {
+		t.Error("Expected token with an unknown kid to fail verification while the issuer is unavailable")
+	}
+	if atomic.LoadInt32(&fetches) != 3 {
+		t.Errorf("Incorrect number of jwks fetches; Expected: %d; Received: %d", 3, atomic.LoadInt32(&fetches))
+	}
+	if err := verifyToken(csrf, rotatedTokenString); err != nil {
+		t.Errorf("Expected the last good jwks to be kept after a failed refresh; Err: %v", err)
+	}
+}
+
+func TestRemoteJWKSOptions(t *testing.T) {
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString: "ES256",
+		PrivateKeyLocation:  "test/ecdsa_256_priv.pem",
+		JWKSURL:             "http://localhost:8080/.well-known/jwks.json",
+	})
+	if authErr == nil {
+		t.Error("Expected an error when using a jwks url on a server that signs tokens")
+	}
+
+	authErr = New(&a, Options{
+		SigningMethodString: "HS256",
+		VerifyOnlyServer:    true,
+		JWKSURL:             "http://localhost:8080/.well-known/jwks.json",
+	})
+	if authErr == nil {
+		t.Error("Expected an error when using a jwks url with an HMAC signing method")
+	}
+}
+
+func TestRemoteJWKSSlowIssuer(t *testing.T) {
+	var issuer Auth
+	authErr := New(&issuer, Options{
+		SigningMethodString: "ES256",
+		PrivateKeyLocation:  "test/ecdsa_256_priv.pem",
+		PublicKeyLocation:   "test/ecdsa_256_pub.pem",
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+
+	handler, err := issuer.JWKSHandler()
+	if err != nil {
+		t.Fatalf("Unable to build jwks handler; Err: %v", err)
+	}
+
+	// every fetch after the first one hangs until the end of the test
+	var fetches int32
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&fetches, 1) > 1 {
+			<-release
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	var verifier Auth
+	authErr = New(&verifier, Options{
+		SigningMethodString:    "ES256",
+		VerifyOnlyServer:       true,
+		JWKSURL:                ts.URL,
+		JWKSCacheTTL:           time.Millisecond,
+		JWKSMinRefreshInterval: time.Millisecond,
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build verify only jwt auth for testing; Err: %v", authErr)
+	}
+
+	var c credentials
+	if err := issuer.buildCredentialsFromClaims(&c, &ClaimsType{}); err != nil {
+		t.Fatalf("Unable to build credentials; Err: %v", err)
+	}
+	tokenString, signErr := issuer.signToken(c.AuthToken.Token)
+	if signErr != nil {
+		t.Fatalf("Unable to sign auth token; Err: %v", signErr)
+	}
+	verifyToken := func() error {
+		var verify credentials
+		if err := verifier.buildCredentialsFromStrings(c.CsrfString, tokenString, "", &verify); err != nil {
+			return err
+		}
+		return verify.AuthToken.ParseErr
+	}
+
+	if err := verifyToken(); err != nil {
+		t.Fatalf("Expected token to verify with the fetched jwks; Err: %v", err)
+	}
+
+	// the cached key is stale, so every request starts a refresh, which hangs
+	time.Sleep(5 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		start := time.Now()
+		if err := verifyToken(); err != nil {
+			t.Errorf("Expected token to verify with the cached jwks; Err: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+			t.Errorf("Expected the cached key to be used without waiting for the issuer; Received: %v", elapsed)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// and a single refresh is running
+	if fetched := atomic.LoadInt32(&fetches); fetched != 2 {
+		t.Errorf("Incorrect number of jwks fetches; Expected: %d; Received: %d", 2, fetched)
+	}
+}
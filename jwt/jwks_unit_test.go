@@ -0,0 +1,156 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJWKThumbprint(t *testing.T) {
+	// example from https://tools.ietf.org/html/rfc7638#section-3.1
+	n, err := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	if err != nil {
+		t.Fatalf("Unable to decode modulus; Err: %v", err)
+	}
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537}
+
+	thumbprint, err := jwkThumbprint(key)
+	if err != nil {
+		t.Errorf("Unable to compute thumbprint; Err: %v", err)
+	}
+	if thumbprint != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Errorf("Incorrect thumbprint; Expected: %s; Received: %s", "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", thumbprint)
+	}
+}
+
+var jwksTests = []struct {
+	options Options
+	kty     string
+	crv     string
+}{
+	{
+		Options{
+			SigningMethodString: "RS256",
+			PrivateKeyLocation:  "test/priv.rsa",
+			PublicKeyLocation:   "test/priv.rsa.pub",
+		},
+		"RSA",
+		"",
+	},
+	{
+		Options{
+			SigningMethodString: "ES384",
+			PublicKeyLocation:   "test/ecdsa_384_pub.pem",
+			VerifyOnlyServer:    true,
+		},
+		"EC",
+		"P-384",
+	},
+	{
+		Options{
+			SigningMethodString: "EdDSA",
+			PrivateKeyLocation:  "test/ed25519_priv.pem",
+			PublicKeyLocation:   "test/ed25519_pub.pem",
+		},
+		"OKP",
+		"Ed25519",
+	},
+}
+
+func TestJWKSHandler(t *testing.T) {
+	for idx, test := range jwksTests {
+		var a Auth
+		authErr := New(&a, test.options)
+		if authErr != nil {
+			t.Fatalf("Unable to build jwt auth for testing; idx: %d; Err: %v", idx, authErr)
+		}
+
+		handler, err := a.JWKSHandler()
+		if err != nil {
+			t.Fatalf("Unable to build jwks handler; idx: %d; Err: %v", idx, err)
+		}
+
+		req, reqErr := http.NewRequest("GET", "http://localhost:8080/.well-known/jwks.json", nil)
+		if reqErr != nil {
+			t.Errorf("Error building request for testing; err: %v", reqErr)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != 200 {
+			t.Errorf("Incorrect response code; idx: %d; Expected: %d; Received: %d", idx, 200, w.Code)
+		}
+		if w.Header().Get("Cache-Control") == "" || w.Header().Get("ETag") == "" {
+			t.Errorf("Expected cache headers on jwks response; idx: %d; Received: %v", idx, w.Header())
+		}
+
+		var set JSONWebKeySet
+		if err := json.Unmarshal(w.Body.Bytes(), &set); err != nil {
+			t.Fatalf("Unable to decode jwks; idx: %d; Err: %v", idx, err)
+		}
+		if len(set.Keys) != 1 {
+			t.Fatalf("Expected one key in jwks; idx: %d; Received: %d", idx, len(set.Keys))
+		}
+
+		jwk := set.Keys[0]
+		if jwk.Kty != test.kty || jwk.Crv != test.crv || jwk.Alg != test.options.SigningMethodString || jwk.Use != "sig" {
+			t.Errorf("Incorrect jwk; idx: %d; Received: %+v", idx, jwk)
+		}
+		if jwk.Kid == "" || jwk.Kid != a.ActiveKeyID() {
+			t.Errorf("Expected jwk kid to match the active kid; idx: %d; Expected: %s; Received: %s", idx, a.ActiveKeyID(), jwk.Kid)
+		}
+
+		// a matching etag means the client's copy is still fresh
+		req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusNotModified {
+			t.Errorf("Incorrect response code; idx: %d; Expected: %d; Received: %d", idx, http.StatusNotModified, w.Code)
+		}
+	}
+
+	// added keys are published as soon as they are trusted
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString: "ES256",
+		PrivateKeyLocation:  "test/ecdsa_256_priv.pem",
+		PublicKeyLocation:   "test/ecdsa_256_pub.pem",
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+	entry, err := a.keys.signingEntry()
+	if err != nil {
+		t.Fatalf("Unable to read signing key; Err: %v", err)
+	}
+	if err := a.AddKey("next", nil, &entry.signKey.(*ecdsa.PrivateKey).PublicKey); err != nil {
+		t.Errorf("Unable to add key; Err: %v", err)
+	}
+	set, err := a.JWKS()
+	if err != nil {
+		t.Errorf("Unable to build jwks; Err: %v", err)
+	}
+	if len(set.Keys) != 2 {
+		t.Errorf("Expected two keys in jwks; Received: %d", len(set.Keys))
+	}
+}
+
+func TestJWKSHandlerHMAC(t *testing.T) {
+	var a Auth
+	authErr := New(&a, newAuthTests[0].options)
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+
+	if _, err := a.JWKSHandler(); err == nil {
+		t.Error("Expected an error when publishing HMAC keys")
+	}
+	if _, err := a.JWKS(); err == nil {
+		t.Error("Expected an error when publishing HMAC keys")
+	}
+}
@@ -2,12 +2,22 @@ package jwt
 
 import (
 	"errors"
-	"log"
+	"log/slog"
+	"strings"
 	"time"
 
 	jwtGo "github.com/golang-jwt/jwt/v5"
 )
 
+const (
+	// values of the token_use claim
+	tokenUseAccess  = "access"
+	tokenUseRefresh = "refresh"
+
+	// typ header of auth tokens, https://www.rfc-editor.org/rfc/rfc9068#section-2.1
+	accessTokenType = "at+jwt"
+)
+
 type jwtToken struct {
 	Token    *jwtGo.Token
 	ParseErr error
@@ -17,31 +27,29 @@ type jwtToken struct {
 type tokenOptions struct {
 	ValidTime           time.Duration
 	SigningMethodString string
-	Debug               bool
+	Logger              *slog.Logger
 }
 
-func (t *jwtToken) myLog(stoofs interface{}) {
-	if t.options.Debug {
-		log.Println(stoofs)
+// log : the logger of the Auth the token was built by
+func (t *jwtToken) log() *slog.Logger {
+	if t.options.Logger == nil {
+		return defaultLogger()
 	}
+	return t.options.Logger
 }
 
 func (c *credentials) buildTokenWithClaimsFromString(tokenString string, verifyKey interface{}, validTime time.Duration) *jwtToken {
 	// note @adam-hanna: should we be checking inputs? Especially the token string?
 	var newToken jwtToken
 
-	token, err := jwtGo.ParseWithClaims(tokenString, &ClaimsType{}, func(token *jwtGo.Token) (interface{}, error) {
-		if token.Method != jwtGo.GetSigningMethod(c.options.SigningMethodString) {
-			c.myLog("Incorrect singing method on token")
-			return nil, errors.New("incorrect singing method on token")
-		}
-		return verifyKey, nil
-	})
+	start := time.Now()
+	token, err := c.codec().decode(tokenString, verifyKey)
+	c.metrics().TokenVerified(time.Since(start))
 
 	if token == nil {
 		token = new(jwtGo.Token)
 		token.Claims = new(ClaimsType)
-		c.myLog("token is nil, set empty token (parse error=" + err.Error() + ")")
+		c.log().Debug("token cannot be parsed", "token", tokenString, "error", err.Error())
 	}
 
 	newToken.Token = token
@@ -49,27 +57,68 @@ func (c *credentials) buildTokenWithClaimsFromString(tokenString string, verifyK
 
 	newToken.options.ValidTime = validTime
 	newToken.options.SigningMethodString = c.options.SigningMethodString
-	newToken.options.Debug = c.options.Debug
+	newToken.options.Logger = c.options.Logger
 
 	return &newToken
 }
 
+// codec : how token strings are decoded
+func (c *credentials) codec() tokenCodec {
+	if c.options.TokenCodec != nil {
+		return c.options.TokenCodec
+	}
+
+	// credentials that weren't built by an Auth hold plain jwts
+	return &jwtCodec{
+		signingMethodString:  c.options.SigningMethodString,
+		acceptSigningMethods: c.options.AcceptSigningMethods,
+	}
+}
+
 func (c *credentials) newTokenWithClaims(claims *ClaimsType, validTime time.Duration) *jwtToken {
 	var newToken jwtToken
 
 	newToken.Token = jwtGo.NewWithClaims(jwtGo.GetSigningMethod(c.options.SigningMethodString), claims)
+	if claims.TokenUse == tokenUseAccess {
+		newToken.Token.Header["typ"] = accessTokenType
+	}
 	newToken.ParseErr = nil
 	newToken.options.ValidTime = validTime
 	newToken.options.SigningMethodString = c.options.SigningMethodString
-	newToken.options.Debug = c.options.Debug
+	newToken.options.Logger = c.options.Logger
 
 	return &newToken
 }
 
-func (t *jwtToken) updateTokenExpiry() *jwtError {
+// checkTokenUse : invalidate the token unless it was issued for the given use. Tokens issued
+// before the claim was introduced don't carry it, and are refused too. When the format has a
+// typ header (jwts do, paseto tokens don't), auth tokens must be typed at+jwt and refresh
+// tokens must not be, so a token is never taken for the other kind by either check alone.
+func (t *jwtToken) checkTokenUse(use string, typed bool) {
+	tokenClaims, ok := t.Token.Claims.(*ClaimsType)
+	if ok && tokenClaims.TokenUse == use && (!typed || t.isAccessTokenType() == (use == tokenUseAccess)) {
+		return
+	}
+
+	t.log().Debug("token refused", append(tokenLogAttrs(t), "reason", reasonOf(ErrWrongTokenType), "expected_token_use", use)...)
+	t.Token.Valid = false
+	// an expired token of the wrong type must not be taken for an expired token of the right one
+	if t.ParseErr == nil || errors.Is(t.ParseErr, jwtGo.ErrTokenExpired) {
+		t.ParseErr = ErrWrongTokenType
+	}
+}
+
+// isAccessTokenType : whether the typ header is at+jwt, which is compared without regard to case
+// and may be given as a media type, https://www.rfc-editor.org/rfc/rfc7515#section-4.1.9
+func (t *jwtToken) isAccessTokenType() bool {
+	typ, _ := t.Token.Header["typ"].(string)
+	return strings.EqualFold(typ, accessTokenType) || strings.EqualFold(typ, "application/"+accessTokenType)
+}
+
+func (t *jwtToken) updateTokenExpiry() *Error {
 	tokenClaims, ok := t.Token.Claims.(*ClaimsType)
 	if !ok {
-		return newJwtError(errors.New("cannot read token claims"), 500)
+		return newReasonError(ErrInvalidClaims, nil, 500)
 	}
 
 	tokenClaims.RegisteredClaims.ExpiresAt = jwtGo.NewNumericDate(time.Now().Add(t.options.ValidTime))
@@ -81,10 +130,10 @@ func (t *jwtToken) updateTokenExpiry() *jwtError {
 	return nil
 }
 
-func (t *jwtToken) updateTokenCsrf(csrfString string) *jwtError {
+func (t *jwtToken) updateTokenCsrf(csrfString string) *Error {
 	tokenClaims, ok := t.Token.Claims.(*ClaimsType)
 	if !ok {
-		return newJwtError(errors.New("cannot read token claims"), 500)
+		return newReasonError(ErrInvalidClaims, nil, 500)
 	}
 
 	tokenClaims.Csrf = csrfString
@@ -95,10 +144,10 @@ func (t *jwtToken) updateTokenCsrf(csrfString string) *jwtError {
 	return nil
 }
 
-func (t *jwtToken) updateTokenExpiryAndCsrf(csrfString string) *jwtError {
+func (t *jwtToken) updateTokenExpiryAndCsrf(csrfString string) *Error {
 	tokenClaims, ok := t.Token.Claims.(*ClaimsType)
 	if !ok {
-		return newJwtError(errors.New("cannot read token claims"), 500)
+		return newReasonError(ErrInvalidClaims, nil, 500)
 	}
 
 	tokenClaims.RegisteredClaims.ExpiresAt = jwtGo.NewNumericDate(time.Now().Add(t.options.ValidTime))
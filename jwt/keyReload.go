@@ -0,0 +1,227 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultKeyWatchInterval = 30 * time.Second
+
+// KeyReloadErrorHandler : called when the keys can't be reloaded. The previous keys stay in use.
+type KeyReloadErrorHandler func(err error)
+
+// defaultKeyReloadErrorHandler : logs the error
+func defaultKeyReloadErrorHandler(logger *slog.Logger) KeyReloadErrorHandler {
+	return func(err error) {
+		logger.Error("keys cannot be reloaded", "error", err.Error())
+	}
+}
+
+// keyReloader : reloads the keys when asked to, or when the key files change
+type keyReloader struct {
+	// serializes reloads and guards the fields below
+	mu           sync.Mutex
+	errorHandler KeyReloadErrorHandler
+	fileStates   map[string]keyFileState
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// keyFileState : what's checked to tell that a key file has been rewritten
+type keyFileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func newKeyReloader(logger *slog.Logger) *keyReloader {
+	return &keyReloader{
+		errorHandler: defaultKeyReloadErrorHandler(logger),
+		fileStates:   make(map[string]keyFileState),
+		stop:         make(chan struct{}),
+	}
+}
+
+func (r *keyReloader) close() {
+	r.stopOnce.Do(func() { close(r.stop) })
+}
+
+// ReloadKeys : read the keys again, e.g. after they have been rewritten on disk. The new key
+// pair replaces the active one atomically. If the reload fails the previous keys stay in use,
+// and the error is returned and passed to the KeyReloadErrorHandler.
+func (a *Auth) ReloadKeys() error {
+	a.reloader.mu.Lock()
+	defer a.reloader.mu.Unlock()
+
+	err := a.reloadKeysLocked()
+	if err != nil {
+		a.reloader.errorHandler(err)
+	}
+
+	return err
+}
+
+// SetKeyReloadErrorHandler : set the function which is called when reloading the keys fails
+func (a *Auth) SetKeyReloadErrorHandler(handler KeyReloadErrorHandler) {
+	a.reloader.mu.Lock()
+	defer a.reloader.mu.Unlock()
+
+	a.reloader.errorHandler = handler
+}
+
+// Close : stop watching the key files and rotating the keys
+func (a *Auth) Close() error {
+	if a.reloader != nil {
+		a.reloader.close()
+	}
+
+	return nil
+}
+
+func (a *Auth) reloadKeysLocked() error {
+	if a.remoteKeys != nil {
+		return errors.New("keys fetched from a jwks url are refreshed automatically")
+	}
+	if a.rotator != nil {
+		// e.g. another instance sharing the KeyStore has rotated the keys
+		return a.rotator.rotate(time.Now())
+	}
+
+	entry, err := a.options.buildKeyPair()
+	if err != nil {
+		return err
+	}
+
+	// key files are rarely rewritten together, so don't swap in half of a new pair
+	if err := checkKeyPair(entry.signKey, entry.verifyKey); err != nil {
+		return err
+	}
+
+	a.keys.swap(entry)
+	a.log().Info("keys reloaded", "kid", entry.kid)
+
+	return nil
+}
+
+// checkKeyPair : make sure the verify key is the public half of the sign key
+func checkKeyPair(signKey interface{}, verifyKey interface{}) error {
+	if signKey == nil {
+		return nil
+	}
+
+	if hmacKey, ok := signKey.([]byte); ok {
+		if !sameKey(hmacKey, verifyKey) {
+			return errors.New("sign and verify keys do not match")
+		}
+		return nil
+	}
+
+	signer, ok := signKey.(crypto.Signer)
+	if !ok {
+		return errors.New("sign key does not have a public key")
+	}
+	if !sameKey(signer.Public(), verifyKey) {
+		return errors.New("sign and verify keys do not match")
+	}
+
+	return nil
+}
+
+// sameKey : whether two verify keys (or hmac keys) are the same
+func sameKey(a interface{}, b interface{}) bool {
+	if aBytes, ok := a.([]byte); ok {
+		bBytes, ok := b.([]byte)
+		return ok && bytes.Equal(aBytes, bBytes)
+	}
+
+	publicKey, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && publicKey.Equal(b)
+}
+
+func (a *Auth) startKeyWatcher(interval time.Duration) {
+	stop := a.reloader.stop
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				a.checkKeyFiles()
+			}
+		}
+	}()
+}
+
+// checkKeyFiles : reload the keys if any of the key files has changed since it was last seen
+func (a *Auth) checkKeyFiles() {
+	a.reloader.mu.Lock()
+	defer a.reloader.mu.Unlock()
+
+	states, err := a.options.statKeyFiles()
+	if err != nil {
+		// e.g. the file is being replaced; try again on the next tick
+		a.reloader.errorHandler(err)
+		return
+	}
+
+	changed := false
+	for location, state := range states {
+		if a.reloader.fileStates[location] != state {
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+
+	// a failed reload is only retried once the files change again
+	a.reloader.fileStates = states
+	if err := a.reloadKeysLocked(); err != nil {
+		a.reloader.errorHandler(err)
+	}
+}
+
+func (o *Options) keyFileLocations() []string {
+	var locations []string
+	if o.PrivateKeyLocation != "" && !o.VerifyOnlyServer {
+		locations = append(locations, o.PrivateKeyLocation)
+	}
+	if o.PublicKeyLocation != "" {
+		locations = append(locations, o.PublicKeyLocation)
+	}
+
+	return locations
+}
+
+func (o *Options) statKeyFiles() (map[string]keyFileState, error) {
+	states := make(map[string]keyFileState)
+	for _, location := range o.keyFileLocations() {
+		var info fs.FileInfo
+		var err error
+		if o.KeyFS != nil {
+			info, err = fs.Stat(o.KeyFS, location)
+		} else {
+			info, err = os.Stat(location)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		states[location] = keyFileState{
+			modTime: info.ModTime(),
+			size:    info.Size(),
+		}
+	}
+
+	return states, nil
+}
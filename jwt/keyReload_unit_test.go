@@ -0,0 +1,265 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeECKeyFiles(t *testing.T, privateKeyLocation string, publicKeyLocation string) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate ECDSA key: %v", err)
+	}
+
+	signBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Unable to encode ECDSA private key: %v", err)
+	}
+	verifyBytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("Unable to encode ECDSA public key: %v", err)
+	}
+
+	if privateKeyLocation != "" {
+		if err := ioutil.WriteFile(privateKeyLocation, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: signBytes}), 0600); err != nil {
+			t.Fatalf("Unable to write ECDSA private key file: %v", err)
+		}
+	}
+	if publicKeyLocation != "" {
+		if err := ioutil.WriteFile(publicKeyLocation, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: verifyBytes}), 0644); err != nil {
+			t.Fatalf("Unable to write ECDSA public key file: %v", err)
+		}
+	}
+
+	return key
+}
+
+func TestWatchKeyFiles(t *testing.T) {
+	dir := t.TempDir()
+	privateKeyLocation := filepath.Join(dir, "app.pem")
+	publicKeyLocation := filepath.Join(dir, "app.pub.pem")
+	writeECKeyFiles(t, privateKeyLocation, publicKeyLocation)
+
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString: "ES256",
+		PrivateKeyLocation:  privateKeyLocation,
+		PublicKeyLocation:   publicKeyLocation,
+		WatchKeyFiles:       true,
+		KeyWatchInterval:    10 * time.Millisecond,
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+	defer a.Close()
+
+	reloadErrs := make(chan error, 100)
+	a.SetKeyReloadErrorHandler(func(err error) {
+		reloadErrs <- err
+	})
+
+	var c credentials
+	var claims ClaimsType
+	if err := a.buildCredentialsFromClaims(&c, &claims); err != nil {
+		t.Errorf("Unable to build credentials; Err: %v", err)
+	}
+	oldTokenString, signErr := a.signToken(c.AuthToken.Token)
+	if signErr != nil {
+		t.Errorf("Unable to sign auth token; Err: %v", signErr)
+	}
+	oldKid := a.ActiveKeyID()
+
+	// rewriting the key files swaps in the new pair
+	writeECKeyFiles(t, privateKeyLocation, publicKeyLocation)
+	deadline := time.Now().Add(2 * time.Second)
+	for a.ActiveKeyID() == oldKid && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if a.ActiveKeyID() == oldKid {
+		t.Fatal("Expected the keys to be reloaded after the key files changed")
+	}
+
+	newTokenString, signErr := a.signToken(c.AuthToken.Token)
+	if signErr != nil {
+		t.Errorf("Unable to sign auth token; Err: %v", signErr)
+	}
+	for _, tokenString := range []string{oldTokenString, newTokenString} {
+		var verify credentials
+		if err := a.buildCredentialsFromStrings(c.CsrfString, tokenString, "", &verify); err != nil {
+			t.Errorf("Unable to build credentials; Err: %v", err)
+		}
+		if verify.AuthToken.ParseErr != nil {
+			t.Errorf("Expected token to verify after the keys were reloaded; Err: %v", verify.AuthToken.ParseErr)
+		}
+	}
+
+	// a key file that doesn't parse keeps the current keys in use
+	reloadedKid := a.ActiveKeyID()
+	if err := ioutil.WriteFile(privateKeyLocation, []byte("not a key"), 0600); err != nil {
+		t.Fatalf("Unable to write key file: %v", err)
+	}
+	select {
+	case err := <-reloadErrs:
+		if err == nil {
+			t.Error("Expected a reload error")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the reload error to be reported")
+	}
+	if a.ActiveKeyID() != reloadedKid {
+		t.Errorf("Expected the keys to be kept after a failed reload; Expected: %s; Received: %s", reloadedKid, a.ActiveKeyID())
+	}
+	if _, err := a.signToken(c.AuthToken.Token); err != nil {
+		t.Errorf("Unable to sign auth token after a failed reload; Err: %v", err)
+	}
+
+	// once closed, changes are no longer picked up
+	a.Close()
+	writeECKeyFiles(t, privateKeyLocation, publicKeyLocation)
+	time.Sleep(50 * time.Millisecond)
+	if a.ActiveKeyID() != reloadedKid {
+		t.Error("Expected the key files to no longer be watched after Close")
+	}
+}
+
+func TestReloadKeys(t *testing.T) {
+	dir := t.TempDir()
+	privateKeyLocation := filepath.Join(dir, "app.pem")
+	publicKeyLocation := filepath.Join(dir, "app.pub.pem")
+	writeECKeyFiles(t, privateKeyLocation, publicKeyLocation)
+
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString: "ES256",
+		KeyID:               "app",
+		PrivateKeyLocation:  privateKeyLocation,
+		PublicKeyLocation:   publicKeyLocation,
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+
+	var reloadErr error
+	a.SetKeyReloadErrorHandler(func(err error) {
+		reloadErr = err
+	})
+
+	// only half of the pair has been rewritten
+	writeECKeyFiles(t, privateKeyLocation, "")
+	if err := a.ReloadKeys(); err == nil {
+		t.Error("Expected an error reloading a mismatched key pair")
+	}
+	if reloadErr == nil {
+		t.Error("Expected the reload error to be reported")
+	}
+
+	key := writeECKeyFiles(t, privateKeyLocation, publicKeyLocation)
+	if err := a.ReloadKeys(); err != nil {
+		t.Errorf("Unable to reload keys; Err: %v", err)
+	}
+
+	// a configured kid is kept, and the key behind it is replaced
+	entry, err := a.keys.signingEntry()
+	if err != nil {
+		t.Fatalf("Unable to read signing key; Err: %v", err)
+	}
+	if entry.kid != "app" || !key.Equal(entry.signKey) {
+		t.Errorf("Expected the reloaded key to be active under the configured kid; Received: %s", entry.kid)
+	}
+
+	authErr = New(&a, Options{
+		SigningMethodString: "HS256",
+		HMACKey:             []byte("test key"),
+		WatchKeyFiles:       true,
+	})
+	if authErr == nil {
+		t.Error("Expected an error when watching key files without a key location")
+	}
+}
+
+func TestReloadKeysWithSameKid(t *testing.T) {
+	var formatTests = []struct {
+		format        string
+		signingMethod string
+		key           []byte
+	}{
+		{"jwt", "HS256", []byte("test key")},
+		{pasetoV4Local, "", bytes.Repeat([]byte("k"), 32)},
+	}
+
+	for _, test := range formatTests {
+		var a Auth
+		authErr := New(&a, Options{
+			TokenFormat:           test.format,
+			SigningMethodString:   test.signingMethod,
+			HMACKey:               test.key,
+			KeyID:                 "app",
+			RefreshTokenValidTime: time.Hour,
+			IsDevEnv:              true,
+		})
+		if authErr != nil {
+			t.Fatalf("Unable to build jwt auth for testing; format: %s; Err: %v", test.format, authErr)
+		}
+
+		issue := func() string {
+			var c credentials
+			if err := a.buildCredentialsFromClaims(&c, &ClaimsType{UID: "user id"}); err != nil {
+				t.Fatalf("Unable to build credentials; format: %s; Err: %v", test.format, err)
+			}
+			tokenString, err := a.encodeToken(c.AuthToken.Token)
+			if err != nil {
+				t.Fatalf("Unable to sign token; format: %s; Err: %v", test.format, err)
+			}
+			return tokenString
+		}
+		verifies := func(tokenString string) bool {
+			var c credentials
+			if err := a.buildCredentialsFromStrings("", tokenString, "", &c); err != nil {
+				t.Fatalf("Unable to build credentials; format: %s; Err: %v", test.format, err)
+			}
+			return c.AuthToken.ParseErr == nil
+		}
+
+		// a token issued before the key behind the kid is replaced
+		before := issue()
+
+		a.options.HMACKey = bytes.Repeat([]byte("n"), len(test.key))
+		if err := a.ReloadKeys(); err != nil {
+			t.Fatalf("Unable to reload keys; format: %s; Err: %v", test.format, err)
+		}
+		if a.ActiveKeyID() != "app" {
+			t.Errorf("Expected the kid to be kept; format: %s; Received: %s", test.format, a.ActiveKeyID())
+		}
+
+		after := issue()
+		if !verifies(before) || !verifies(after) {
+			t.Errorf("Expected the tokens issued before and after the reload to verify; format: %s", test.format)
+		}
+
+		// once the replaced key has been retired for longer than a refresh token is valid
+		entry := a.keys.entries["app"]
+		if len(entry.superseded) != 1 {
+			t.Fatalf("Expected the replaced key to be kept; format: %s; Received: %d keys", test.format, len(entry.superseded))
+		}
+		entry.superseded[0].retiredAt = time.Now().Add(-2 * time.Hour)
+		if verifies(before) || !verifies(after) {
+			t.Errorf("Expected only the token issued after the reload to verify; format: %s", test.format)
+		}
+
+		// reloading the same key again doesn't retire it
+		if err := a.ReloadKeys(); err != nil {
+			t.Fatalf("Unable to reload keys; format: %s; Err: %v", test.format, err)
+		}
+		if len(a.keys.entries["app"].superseded) != 0 || !verifies(after) {
+			t.Errorf("Expected an unchanged key to be kept as it is; format: %s", test.format)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultKeyPrePublishTime = 24 * time.Hour
+
+	// how often the schedule is checked, at most
+	maxKeyRotationCheckInterval = 1 * time.Minute
+
+	generatedRSAKeyBits = 2048
+)
+
+// KeyStore : persists generated keys, so that a restart doesn't invalidate the tokens they signed.
+// Keys are saved as a whole every time the schedule changes.
+type KeyStore interface {
+	LoadKeys() ([]StoredKey, error)
+	SaveKeys(keys []StoredKey) error
+}
+
+// StoredKey : a generated key and when it's used for signing. A key is published for
+// verification as soon as it's stored, and retires when the next key becomes active.
+type StoredKey struct {
+	Kid       string    `json:"kid"`
+	Alg       string    `json:"alg"`
+	Key       []byte    `json:"key"` // PKCS#8 for RSA, ECDSA and EdDSA keys; the raw secret for HMAC keys
+	CreatedAt time.Time `json:"createdAt"`
+	ActiveAt  time.Time `json:"activeAt"`
+}
+
+// keyRotator : generates keys and moves them through the keyring on a schedule
+type keyRotator struct {
+	signingMethodString string
+	interval            time.Duration
+	prePublishTime      time.Duration
+	retiredKeyValidTime time.Duration
+	store               KeyStore
+	keys                *keyring
+
+	// serializes rotations and guards scheduled
+	mu        sync.Mutex
+	scheduled []StoredKey
+}
+
+func newKeyRotator(o *Options, keys *keyring) *keyRotator {
+	return &keyRotator{
+		signingMethodString: o.SigningMethodString,
+		interval:            o.KeyRotationInterval,
+		prePublishTime:      o.KeyPrePublishTime,
+		retiredKeyValidTime: o.RefreshTokenValidTime,
+		store:               o.KeyStore,
+		keys:                keys,
+	}
+}
+
+// checkInterval : often enough to never be late for a scheduled step by much
+func (r *keyRotator) checkInterval() time.Duration {
+	interval := maxKeyRotationCheckInterval
+	if r.interval/4 < interval {
+		interval = r.interval / 4
+	}
+	if r.prePublishTime > 0 && r.prePublishTime/4 < interval {
+		interval = r.prePublishTime / 4
+	}
+
+	return interval
+}
+
+// rotate : bring the schedule up to date, generating keys as needed, and update the keyring
+// to match it
+func (r *keyRotator) rotate(now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// other instances sharing the store may have generated keys already
+	scheduled := r.scheduled
+	if r.store != nil {
+		stored, err := r.store.LoadKeys()
+		if err != nil {
+			return err
+		}
+
+		scheduled = nil
+		for _, key := range stored {
+			// keys of another signing method can't be used, e.g. after a configuration change
+			if key.Alg == r.signingMethodString {
+				scheduled = append(scheduled, key)
+			}
+		}
+	}
+	sort.Slice(scheduled, func(i, j int) bool { return scheduled[i].ActiveAt.Before(scheduled[j].ActiveAt) })
+
+	// drop the keys that are no longer trusted
+	changed := false
+	var kept []StoredKey
+	for i, key := range scheduled {
+		if i+1 < len(scheduled) && now.After(scheduled[i+1].ActiveAt.Add(r.retiredKeyValidTime)) {
+			changed = true
+			continue
+		}
+		kept = append(kept, key)
+	}
+	scheduled = kept
+
+	current := -1
+	for i, key := range scheduled {
+		if !key.ActiveAt.After(now) {
+			current = i
+		}
+	}
+
+	// nothing to sign with yet, e.g. on the very first start
+	if current == -1 {
+		key, err := r.generate(now, now)
+		if err != nil {
+			return err
+		}
+		scheduled = append([]StoredKey{key}, scheduled...)
+		current = 0
+		changed = true
+	}
+
+	// publish the next key ahead of time, so verifiers have it before it's used
+	if current == len(scheduled)-1 && !now.Before(scheduled[current].ActiveAt.Add(r.interval-r.prePublishTime)) {
+		activeAt := scheduled[current].ActiveAt.Add(r.interval)
+		if activeAt.Before(now.Add(r.prePublishTime)) {
+			// the schedule was missed (e.g. nothing was running), so don't activate an unpublished key
+			activeAt = now.Add(r.prePublishTime)
+		}
+
+		key, err := r.generate(now, activeAt)
+		if err != nil {
+			return err
+		}
+		scheduled = append(scheduled, key)
+		changed = true
+	}
+
+	if changed && r.store != nil {
+		if err := r.store.SaveKeys(scheduled); err != nil {
+			return err
+		}
+	}
+
+	entries := make([]keyringEntry, 0, len(scheduled))
+	for i, key := range scheduled {
+		signKey, verifyKey, err := decodeStoredKey(key)
+		if err != nil {
+			return err
+		}
+
+		entry := keyringEntry{
+			kid:       key.Kid,
+			signKey:   signKey,
+			verifyKey: verifyKey,
+		}
+		if i < current {
+			entry.retiredAt = scheduled[i+1].ActiveAt
+		}
+		entries = append(entries, entry)
+	}
+
+	r.scheduled = scheduled
+	r.keys.update(entries, scheduled[current].Kid)
+
+	return nil
+}
+
+func (r *keyRotator) generate(now time.Time, activeAt time.Time) (StoredKey, error) {
+	key, err := generateKey(r.signingMethodString)
+	if err != nil {
+		return StoredKey{}, err
+	}
+
+	stored := StoredKey{
+		Alg:       r.signingMethodString,
+		Key:       key,
+		CreatedAt: now,
+		ActiveAt:  activeAt,
+	}
+
+	// public keys are known by their thumbprint, like keys read from disk
+	if isHMACSigningMethod(r.signingMethodString) {
+		kid := make([]byte, 16)
+		if _, err := rand.Read(kid); err != nil {
+			return StoredKey{}, err
+		}
+		stored.Kid = base64.RawURLEncoding.EncodeToString(kid)
+	} else {
+		_, verifyKey, err := decodeStoredKey(stored)
+		if err != nil {
+			return StoredKey{}, err
+		}
+		stored.Kid, err = jwkThumbprint(verifyKey)
+		if err != nil {
+			return StoredKey{}, err
+		}
+	}
+
+	return stored, nil
+}
+
+// generateKey : a new key for the signing method, encoded as it's stored
+func generateKey(signingMethodString string) ([]byte, error) {
+	var (
+		key crypto.PrivateKey
+		err error
+	)
+
+	switch signingMethodString {
+	case "HS256":
+		return randomBytes(32)
+	case "HS384":
+		return randomBytes(48)
+	case "HS512":
+		return randomBytes(64)
+	case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+		key, err = rsa.GenerateKey(rand.Reader, generatedRSAKeyBits)
+	case "ES256":
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ES384":
+		key, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "ES512":
+		key, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case "EdDSA":
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, errors.New("signing method string not recognized")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.MarshalPKCS8PrivateKey(key)
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func decodeStoredKey(key StoredKey) (signKey interface{}, verifyKey interface{}, err error) {
+	if isHMACSigningMethod(key.Alg) {
+		return key.Key, key.Key, nil
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(key.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.New("stored key cannot be used for signing")
+	}
+	if err := checkKeyTypes(key.Alg, signer, signer.Public()); err != nil {
+		return nil, nil, err
+	}
+
+	return signer, signer.Public(), nil
+}
+
+func (a *Auth) startKeyRotation() {
+	stop := a.reloader.stop
+	interval := a.rotator.checkInterval()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				a.rotateKeys()
+			}
+		}
+	}()
+}
+
+func (a *Auth) rotateKeys() {
+	a.reloader.mu.Lock()
+	defer a.reloader.mu.Unlock()
+
+	if err := a.rotator.rotate(time.Now()); err != nil {
+		a.reloader.errorHandler(err)
+	}
+}
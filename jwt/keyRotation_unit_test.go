@@ -0,0 +1,185 @@
+package jwt
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func kidsInKeyring(a *Auth) map[string]bool {
+	kids := make(map[string]bool)
+	for _, entry := range a.keys.verifyEntries() {
+		kids[entry.kid] = true
+	}
+
+	return kids
+}
+
+func TestScheduledKeyRotation(t *testing.T) {
+	keyStore := NewFileKeyStore(filepath.Join(t.TempDir(), "keys.json"))
+	options := Options{
+		SigningMethodString:   "ES256",
+		KeyRotationInterval:   30 * 24 * time.Hour,
+		KeyStore:              keyStore,
+		RefreshTokenValidTime: 72 * time.Hour,
+	}
+
+	var a Auth
+	authErr := New(&a, options)
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+	defer a.Close()
+	if a.options.KeyPrePublishTime != defaultKeyPrePublishTime {
+		t.Errorf("Expected the default pre publish time; Expected: %v; Received: %v", defaultKeyPrePublishTime, a.options.KeyPrePublishTime)
+	}
+
+	firstKid := a.ActiveKeyID()
+	if firstKid == "" || len(kidsInKeyring(&a)) != 1 {
+		t.Fatalf("Expected a single generated key; Received: %v", kidsInKeyring(&a))
+	}
+
+	var c credentials
+	var claims ClaimsType
+	if err := a.buildCredentialsFromClaims(&c, &claims); err != nil {
+		t.Errorf("Unable to build credentials; Err: %v", err)
+	}
+	firstTokenString, signErr := a.signToken(c.AuthToken.Token)
+	if signErr != nil {
+		t.Fatalf("Unable to sign auth token; Err: %v", signErr)
+	}
+
+	stored, err := keyStore.LoadKeys()
+	if err != nil || len(stored) != 1 {
+		t.Fatalf("Expected the generated key to be stored; Received: %d keys; Err: %v", len(stored), err)
+	}
+	start := stored[0].ActiveAt
+
+	// nothing changes until the next key is due to be published
+	if err := a.rotator.rotate(start.Add(28 * 24 * time.Hour)); err != nil {
+		t.Fatalf("Unable to rotate keys; Err: %v", err)
+	}
+	if len(kidsInKeyring(&a)) != 1 {
+		t.Errorf("Expected the next key to not be published yet; Received: %v", kidsInKeyring(&a))
+	}
+
+	// the next key is published a day ahead, but not used for signing yet
+	if err := a.rotator.rotate(start.Add(29*24*time.Hour + time.Minute)); err != nil {
+		t.Fatalf("Unable to rotate keys; Err: %v", err)
+	}
+	kids := kidsInKeyring(&a)
+	if len(kids) != 2 || a.ActiveKeyID() != firstKid {
+		t.Fatalf("Expected the next key to be published but not active; Received: %v; active: %s", kids, a.ActiveKeyID())
+	}
+	var secondKid string
+	for kid := range kids {
+		if kid != firstKid {
+			secondKid = kid
+		}
+	}
+	set, err := a.JWKS()
+	if err != nil {
+		t.Errorf("Unable to build jwks; Err: %v", err)
+	}
+	if len(set.Keys) != 2 {
+		t.Errorf("Expected the next key to be in the jwks; Received: %d keys", len(set.Keys))
+	}
+
+	// on schedule, the next key becomes active and the first one is still trusted
+	if err := a.rotator.rotate(start.Add(30*24*time.Hour + time.Minute)); err != nil {
+		t.Fatalf("Unable to rotate keys; Err: %v", err)
+	}
+	if a.ActiveKeyID() != secondKid {
+		t.Errorf("Expected the next key to be active; Expected: %s; Received: %s", secondKid, a.ActiveKeyID())
+	}
+	var verify credentials
+	if err := a.buildCredentialsFromStrings(c.CsrfString, firstTokenString, "", &verify); err != nil {
+		t.Errorf("Unable to build credentials; Err: %v", err)
+	}
+	if verify.AuthToken.ParseErr != nil {
+		t.Errorf("Expected a token signed by the retired key to verify; Err: %v", verify.AuthToken.ParseErr)
+	}
+
+	// a restart picks up the stored keys instead of generating new ones
+	var restarted Auth
+	if err := New(&restarted, options); err != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", err)
+	}
+	defer restarted.Close()
+	if err := restarted.rotator.rotate(start.Add(30*24*time.Hour + 2*time.Minute)); err != nil {
+		t.Fatalf("Unable to rotate keys; Err: %v", err)
+	}
+	if restarted.ActiveKeyID() != secondKid || !kidsInKeyring(&restarted)[firstKid] {
+		t.Errorf("Expected the stored keys to be used after a restart; Received: %v; active: %s", kidsInKeyring(&restarted), restarted.ActiveKeyID())
+	}
+
+	// once tokens signed by the retired key have expired, it's dropped
+	if err := a.rotator.rotate(start.Add(33*24*time.Hour + 2*time.Minute)); err != nil {
+		t.Fatalf("Unable to rotate keys; Err: %v", err)
+	}
+	if kidsInKeyring(&a)[firstKid] {
+		t.Error("Expected the retired key to be dropped after RefreshTokenValidTime")
+	}
+	stored, err = keyStore.LoadKeys()
+	if err != nil || len(stored) != 1 || stored[0].Kid != secondKid {
+		t.Errorf("Expected only the active key to be stored; Received: %d keys; Err: %v", len(stored), err)
+	}
+}
+
+func TestScheduledKeyRotationMissedSchedule(t *testing.T) {
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString: "HS256",
+		KeyRotationInterval: 30 * 24 * time.Hour,
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+	defer a.Close()
+	firstKid := a.ActiveKeyID()
+
+	// a key that was never published is not used for signing straight away
+	now := time.Now().Add(60 * 24 * time.Hour)
+	if err := a.rotator.rotate(now); err != nil {
+		t.Fatalf("Unable to rotate keys; Err: %v", err)
+	}
+	if a.ActiveKeyID() != firstKid || len(kidsInKeyring(&a)) != 2 {
+		t.Errorf("Expected the next key to be published before it's used; Received: %v; active: %s", kidsInKeyring(&a), a.ActiveKeyID())
+	}
+	if err := a.rotator.rotate(now.Add(defaultKeyPrePublishTime)); err != nil {
+		t.Fatalf("Unable to rotate keys; Err: %v", err)
+	}
+	if a.ActiveKeyID() == firstKid {
+		t.Error("Expected the next key to be active after the pre publish time")
+	}
+
+	var c credentials
+	var claims ClaimsType
+	if err := a.buildCredentialsFromClaims(&c, &claims); err != nil {
+		t.Errorf("Unable to build credentials; Err: %v", err)
+	}
+	if _, err := a.signToken(c.AuthToken.Token); err != nil {
+		t.Errorf("Unable to sign auth token with a generated HMAC key; Err: %v", err)
+	}
+}
+
+func TestScheduledKeyRotationOptions(t *testing.T) {
+	var optionTests = []struct {
+		name    string
+		options Options
+	}{
+		{"configured key", Options{SigningMethodString: "HS256", HMACKey: []byte("test key"), KeyRotationInterval: time.Hour}},
+		{"configured key file", Options{SigningMethodString: "RS256", PrivateKeyLocation: "test/priv.rsa", KeyRotationInterval: time.Hour}},
+		{"verify only", Options{SigningMethodString: "RS256", VerifyOnlyServer: true, KeyRotationInterval: time.Hour}},
+		{"long pre publish time", Options{SigningMethodString: "HS256", KeyRotationInterval: time.Hour, KeyPrePublishTime: time.Hour}},
+		{"store without rotation", Options{SigningMethodString: "HS256", HMACKey: []byte("test key"), KeyStore: NewFileKeyStore("keys.json")}},
+		{"unknown signing method", Options{SigningMethodString: "none", KeyRotationInterval: time.Hour}},
+	}
+
+	for _, test := range optionTests {
+		var a Auth
+		if err := New(&a, test.options); err == nil {
+			t.Errorf("Expected an error building jwt auth; test: %s", test.name)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"hash"
+	"io/fs"
+	"io/ioutil"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// pemParser : parses a PEM encoded key, e.g. jwtGo.ParseRSAPrivateKeyFromPEM
+type pemParser func(pemBytes []byte) (interface{}, error)
+
+// buildAsymmetricKeys : load the key pair from whichever source has been configured. Keys
+// given as PEM data are parsed with the given functions.
+func (o *Options) buildAsymmetricKeys(parsePrivateKey pemParser, parsePublicKey pemParser) (signKey interface{}, verifyKey interface{}, err error) {
+	// check to make sure the provided options are valid
+	privateSources := countKeySources(o.Signer != nil, o.PrivateKey != nil, len(o.PrivateKeyPEM) > 0, o.PrivateKeyLocation != "")
+	publicSources := countKeySources(o.PublicKey != nil, len(o.PublicKeyPEM) > 0, o.PublicKeyLocation != "")
+	if privateSources > 1 {
+		err = errors.New("only one of Signer, PrivateKey, PrivateKeyPEM or PrivateKeyLocation can be set")
+		return
+	}
+	if publicSources > 1 {
+		err = errors.New("only one of PublicKey, PublicKeyPEM or PublicKeyLocation can be set")
+		return
+	}
+	if privateSources == 0 && !o.VerifyOnlyServer {
+		err = errors.New("a private key is required")
+		return
+	}
+	if publicSources == 0 {
+		// the public half of a signer or an in-memory private key is always at hand
+		signer, ok := o.PrivateKey.(crypto.Signer)
+		if o.Signer != nil {
+			signer, ok = o.Signer, true
+		}
+		if !ok || o.VerifyOnlyServer {
+			err = errors.New("a public key is required")
+			return
+		}
+		verifyKey = signer.Public()
+	}
+
+	if !o.VerifyOnlyServer {
+		signKey, err = o.readPrivateKey(parsePrivateKey)
+		if err != nil {
+			return
+		}
+	}
+
+	if verifyKey == nil {
+		verifyKey, err = o.readPublicKey(parsePublicKey)
+		if err != nil {
+			return
+		}
+	}
+
+	// in-memory keys haven't been through a parser, so make sure they suit the signing method
+	err = checkKeyTypes(o.SigningMethodString, signKey, verifyKey)
+	return
+}
+
+func countKeySources(sources ...bool) int {
+	var count int
+	for _, set := range sources {
+		if set {
+			count++
+		}
+	}
+
+	return count
+}
+
+// hasKeySource : whether any key has been configured, in any form
+func (o *Options) hasKeySource() bool {
+	return countKeySources(o.Signer != nil, o.PrivateKey != nil, len(o.PrivateKeyPEM) > 0, o.PrivateKeyLocation != "",
+		o.PublicKey != nil, len(o.PublicKeyPEM) > 0, o.PublicKeyLocation != "", len(o.HMACKey) > 0) > 0
+}
+
+func (o *Options) readPrivateKey(parse pemParser) (interface{}, error) {
+	if o.Signer != nil {
+		return o.Signer, nil
+	}
+	if o.PrivateKey != nil {
+		return o.PrivateKey, nil
+	}
+
+	signBytes := o.PrivateKeyPEM
+	if len(signBytes) == 0 {
+		var err error
+		signBytes, err = o.readKeyFile(o.PrivateKeyLocation)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	signBytes, err := decryptPrivateKeyPEM(signBytes, o.PrivateKeyPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	return parse(signBytes)
+}
+
+func (o *Options) readPublicKey(parse pemParser) (interface{}, error) {
+	if o.PublicKey != nil {
+		return o.PublicKey, nil
+	}
+
+	verifyBytes := o.PublicKeyPEM
+	if len(verifyBytes) == 0 {
+		var err error
+		verifyBytes, err = o.readKeyFile(o.PublicKeyLocation)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the key of a certificate chain is the key of its leaf; the chain itself is checked later
+	certificates, err := parseCertificatesPEM(verifyBytes)
+	if err != nil {
+		return nil, err
+	}
+	if len(certificates) > 0 {
+		return certificates[0].PublicKey, nil
+	}
+
+	return parse(verifyBytes)
+}
+
+// readKeyFile : key locations are paths in KeyFS (e.g. an embed.FS) when it's set, and on
+// disk otherwise
+func (o *Options) readKeyFile(location string) ([]byte, error) {
+	if o.KeyFS != nil {
+		return fs.ReadFile(o.KeyFS, location)
+	}
+
+	return ioutil.ReadFile(location)
+}
+
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidAES128CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// https://tools.ietf.org/html/rfc5208#section-6
+type encryptedPrivateKeyInfo struct {
+	EncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedData       []byte
+}
+
+// https://tools.ietf.org/html/rfc8018#appendix-A.4
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// https://tools.ietf.org/html/rfc8018#appendix-A.2
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// decryptPrivateKeyPEM : decrypt a password protected PKCS#8 private key ("ENCRYPTED PRIVATE KEY"),
+// as written by `openssl pkcs8 -topk8 -v2 aes-256-cbc`. Any other PEM data is returned unchanged.
+// Only PBES2 with PBKDF2 and AES-CBC is supported; the older PBES1 schemes are too weak to be worth it.
+func decryptPrivateKeyPEM(pemBytes []byte, password []byte) ([]byte, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil || block.Type != "ENCRYPTED PRIVATE KEY" {
+		return pemBytes, nil
+	}
+	if len(password) == 0 {
+		return nil, errors.New("private key is encrypted, please provide a PrivateKeyPassword")
+	}
+
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(block.Bytes, &info); err != nil {
+		return nil, err
+	}
+	if !info.EncryptionAlgorithm.Algorithm.Equal(oidPBES2) {
+		return nil, errors.New("unsupported private key encryption, only PBES2 is supported")
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.EncryptionAlgorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, errors.New("unsupported private key derivation function, only PBKDF2 is supported")
+	}
+
+	var kdfParams pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, err
+	}
+
+	var prf func() hash.Hash
+	switch {
+	case len(kdfParams.PRF.Algorithm) == 0 || kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	case kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA384):
+		prf = sha512.New384
+	case kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA512):
+		prf = sha512.New
+	default:
+		return nil, errors.New("unsupported PBKDF2 pseudorandom function")
+	}
+
+	var keyLen int
+	switch {
+	case params.EncryptionScheme.Algorithm.Equal(oidAES128CBC):
+		keyLen = 16
+	case params.EncryptionScheme.Algorithm.Equal(oidAES192CBC):
+		keyLen = 24
+	case params.EncryptionScheme.Algorithm.Equal(oidAES256CBC):
+		keyLen = 32
+	default:
+		return nil, errors.New("unsupported private key cipher, only AES-CBC is supported")
+	}
+	if kdfParams.KeyLength != 0 && kdfParams.KeyLength != keyLen {
+		return nil, errors.New("PBKDF2 key length does not match the cipher")
+	}
+	if kdfParams.IterationCount <= 0 {
+		return nil, errors.New("invalid PBKDF2 iteration count")
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, errors.New("invalid AES-CBC iv")
+	}
+
+	blockCipher, err := aes.NewCipher(pbkdf2.Key(password, kdfParams.Salt, kdfParams.IterationCount, keyLen, prf))
+	if err != nil {
+		return nil, err
+	}
+
+	data := info.EncryptedData
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid encrypted private key length")
+	}
+	decrypted := make([]byte, len(data))
+	cipher.NewCBCDecrypter(blockCipher, iv).CryptBlocks(decrypted, data)
+
+	// a wrong password gives bad padding, or, once in a while, valid padding around garbage,
+	// so the key is only taken once it parses
+	wrongPassword := errors.New("unable to decrypt private key, is the password correct?")
+	padding := int(decrypted[len(decrypted)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, wrongPassword
+	}
+	for _, b := range decrypted[len(decrypted)-padding:] {
+		if int(b) != padding {
+			return nil, wrongPassword
+		}
+	}
+	decrypted = decrypted[:len(decrypted)-padding]
+	if _, err := x509.ParsePKCS8PrivateKey(decrypted); err != nil {
+		return nil, wrongPassword
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: decrypted,
+	}), nil
+}
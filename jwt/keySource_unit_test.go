@@ -0,0 +1,208 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
+)
+
+func TestDecryptPrivateKeyPEM(t *testing.T) {
+	// made with `openssl pkcs8 -topk8 -v2 <cipher> [-v2prf <prf>] -passout pass:test-password`
+	var decryptTests = []struct {
+		name      string
+		encrypted string
+		plain     string
+		parse     pemParser
+	}{
+		{"AES-256 and HMAC-SHA256", "test/ed25519_pkcs8_encrypted.pem", "test/ed25519_priv.pem", parseEdPrivateKey},
+		{"AES-192 and HMAC-SHA512", "test/ecdsa_384_pkcs8_encrypted.pem", "test/ecdsa_384_priv.pem", parseECPrivateKey},
+		{"AES-128 and HMAC-SHA1", "test/ecdsa_256_pkcs8_encrypted.pem", "test/ecdsa_256_pkcs8.pem", parseECPrivateKey},
+	}
+
+	for _, test := range decryptTests {
+		encrypted, err := ioutil.ReadFile(test.encrypted)
+		if err != nil {
+			t.Fatalf("Unable to read encrypted private key file: %v", err)
+		}
+		plain, err := ioutil.ReadFile(test.plain)
+		if err != nil {
+			t.Fatalf("Unable to read private key file: %v", err)
+		}
+
+		decrypted, err := decryptPrivateKeyPEM(encrypted, []byte("test-password"))
+		if err != nil {
+			t.Errorf("[%s] Unable to decrypt private key; Err: %v", test.name, err)
+			continue
+		}
+		key, err := test.parse(decrypted)
+		if err != nil {
+			t.Errorf("[%s] Unable to parse decrypted private key; Err: %v", test.name, err)
+			continue
+		}
+		expected, err := test.parse(plain)
+		if err != nil {
+			t.Fatalf("Unable to parse private key: %v", err)
+		}
+		if !key.(interface{ Equal(crypto.PrivateKey) bool }).Equal(expected) {
+			t.Errorf("[%s] Expected the decrypted key to be the openssl one", test.name)
+		}
+	}
+
+	// about one wrong password in 256 leaves valid padding; none of them may give a key
+	encrypted, err := ioutil.ReadFile("test/ed25519_pkcs8_encrypted.pem")
+	if err != nil {
+		t.Fatalf("Unable to read encrypted private key file: %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		if _, err := decryptPrivateKeyPEM(encrypted, []byte(fmt.Sprintf("wrong-password-%d", i))); err == nil {
+			t.Fatalf("Expected an error decrypting with a wrong password; password: wrong-password-%d", i)
+		}
+	}
+}
+
+func TestKeySources(t *testing.T) {
+	signBytes, err := ioutil.ReadFile("test/priv.rsa")
+	if err != nil {
+		t.Fatalf("Unable to read RSA private key file: %v", err)
+	}
+	verifyBytes, err := ioutil.ReadFile("test/priv.rsa.pub")
+	if err != nil {
+		t.Fatalf("Unable to read RSA public key file: %v", err)
+	}
+	rsaKey, err := jwtGo.ParseRSAPrivateKeyFromPEM(signBytes)
+	if err != nil {
+		t.Fatalf("Unable to parse RSA private key: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate EdDSA key: %v", err)
+	}
+
+	var keySourceTests = []struct {
+		name    string
+		options Options
+		valid   bool
+	}{
+		{
+			"in-memory key pair",
+			Options{SigningMethodString: "RS256", PrivateKey: rsaKey, PublicKey: &rsaKey.PublicKey},
+			true,
+		},
+		{
+			"in-memory private key only",
+			Options{SigningMethodString: "RS256", PrivateKey: rsaKey},
+			true,
+		},
+		{
+			"in-memory Ed25519 private key only",
+			Options{SigningMethodString: "EdDSA", PrivateKey: edKey},
+			true,
+		},
+		{
+			"in-memory key of the wrong type",
+			Options{SigningMethodString: "ES256", PrivateKey: rsaKey},
+			false,
+		},
+		{
+			"in-memory public key on a verify only server",
+			Options{SigningMethodString: "RS256", PublicKey: &rsaKey.PublicKey, VerifyOnlyServer: true},
+			true,
+		},
+		{
+			"PEM bytes",
+			Options{SigningMethodString: "RS256", PrivateKeyPEM: signBytes, PublicKeyPEM: verifyBytes},
+			true,
+		},
+		{
+			"more than one private key source",
+			Options{SigningMethodString: "RS256", PrivateKey: rsaKey, PrivateKeyLocation: "test/priv.rsa", PublicKeyPEM: verifyBytes},
+			false,
+		},
+		{
+			"fs.FS",
+			Options{SigningMethodString: "RS256", KeyFS: os.DirFS("test"), PrivateKeyLocation: "priv.rsa", PublicKeyLocation: "priv.rsa.pub"},
+			true,
+		},
+		{
+			"fs.FS with a missing file",
+			Options{SigningMethodString: "RS256", KeyFS: os.DirFS("test"), PrivateKeyLocation: "test/priv.rsa", PublicKeyLocation: "priv.rsa.pub"},
+			false,
+		},
+		{
+			"PKCS#8 private key",
+			Options{SigningMethodString: "ES256", PrivateKeyLocation: "test/ecdsa_256_pkcs8.pem", PublicKeyLocation: "test/ecdsa_256_pub.pem"},
+			true,
+		},
+		{
+			"encrypted PKCS#8 private key, AES-256 and HMAC-SHA256",
+			Options{SigningMethodString: "RS256", PrivateKeyLocation: "test/priv_pkcs8_encrypted.pem", PrivateKeyPassword: []byte("test-password"), PublicKeyLocation: "test/priv.rsa.pub"},
+			true,
+		},
+		{
+			"encrypted PKCS#8 private key, AES-128 and HMAC-SHA1",
+			Options{SigningMethodString: "ES256", PrivateKeyLocation: "test/ecdsa_256_pkcs8_encrypted.pem", PrivateKeyPassword: []byte("test-password"), PublicKeyLocation: "test/ecdsa_256_pub.pem"},
+			true,
+		},
+		{
+			"encrypted PKCS#8 private key with the wrong password",
+			Options{SigningMethodString: "RS256", PrivateKeyLocation: "test/priv_pkcs8_encrypted.pem", PrivateKeyPassword: []byte("wrong-password"), PublicKeyLocation: "test/priv.rsa.pub"},
+			false,
+		},
+		{
+			"encrypted PKCS#8 private key without a password",
+			Options{SigningMethodString: "RS256", PrivateKeyLocation: "test/priv_pkcs8_encrypted.pem", PublicKeyLocation: "test/priv.rsa.pub"},
+			false,
+		},
+	}
+
+	for idx, test := range keySourceTests {
+		var a Auth
+		authErr := New(&a, test.options)
+		if !test.valid {
+			if authErr == nil {
+				t.Errorf("Building auth succeeded when passed invalid options; idx: %d; name: %s", idx, test.name)
+			}
+			continue
+		}
+		if authErr != nil {
+			t.Errorf("Building auth failed when passed valid options; idx: %d; name: %s; Err: %v", idx, test.name, authErr)
+			continue
+		}
+		if test.options.VerifyOnlyServer {
+			continue
+		}
+
+		// the loaded keys must be able to sign and verify a token
+		var c credentials
+		var claims ClaimsType
+		if err := a.buildCredentialsFromClaims(&c, &claims); err != nil {
+			t.Errorf("Unable to build credentials; idx: %d; name: %s; Err: %v", idx, test.name, err)
+		}
+		tokenString, signErr := a.signToken(c.AuthToken.Token)
+		if signErr != nil {
+			t.Errorf("Unable to sign auth token; idx: %d; name: %s; Err: %v", idx, test.name, signErr)
+		}
+
+		var verify credentials
+		if err := a.buildCredentialsFromStrings(c.CsrfString, tokenString, "", &verify); err != nil {
+			t.Errorf("Unable to build credentials; idx: %d; name: %s; Err: %v", idx, test.name, err)
+		}
+		if verify.AuthToken.ParseErr != nil {
+			t.Errorf("Unable to verify auth token; idx: %d; name: %s; Err: %v", idx, test.name, verify.AuthToken.ParseErr)
+		}
+	}
+}
+
+func parseEdPrivateKey(pemBytes []byte) (interface{}, error) {
+	return jwtGo.ParseEdPrivateKeyFromPEM(pemBytes)
+}
+
+func parseECPrivateKey(pemBytes []byte) (interface{}, error) {
+	return jwtGo.ParseECPrivateKeyFromPEM(pemBytes)
+}
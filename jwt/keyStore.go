@@ -0,0 +1,66 @@
+package jwt
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// FileKeyStore : a KeyStore that keeps the keys in a json file. The file holds private keys,
+// so it's only readable by its owner.
+type FileKeyStore struct {
+	path string
+}
+
+// NewFileKeyStore : a KeyStore backed by the file at path, which is created on the first save
+func NewFileKeyStore(path string) *FileKeyStore {
+	return &FileKeyStore{path: path}
+}
+
+// LoadKeys : read the stored keys. A missing file holds no keys.
+func (s *FileKeyStore) LoadKeys() ([]StoredKey, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []StoredKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// SaveKeys : replace the stored keys. The file is replaced in a single step, so it's never
+// seen half written.
+func (s *FileKeyStore) SaveKeys(keys []StoredKey) error {
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
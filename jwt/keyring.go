@@ -0,0 +1,376 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
+)
+
+// keyResolver : looks up the key that should be used to verify a parsed (but not yet verified) token
+type keyResolver interface {
+	verifyKeyForToken(token *jwtGo.Token) (interface{}, error)
+}
+
+// keyringEntry : a single key pair held by the keyring
+type keyringEntry struct {
+	kid       string
+	signKey   interface{}
+	verifyKey interface{}
+	retiredAt time.Time
+
+	// the chain of the verify key, leaf first, when it was given as a certificate
+	certificates []*x509.Certificate
+
+	// keys replaced under the same kid by a reload, newest first. Tokens they signed carry the
+	// kid too, so they're still tried until they expire.
+	superseded []keyringEntry
+}
+
+// keyring : holds every trusted verification key indexed by kid, and the kid of the key
+// that is currently used for signing
+type keyring struct {
+	mu        sync.RWMutex
+	entries   map[string]*keyringEntry
+	activeKid string
+
+	// tokens issued before a kid was configured don't carry one, and are verified with this key
+	defaultKid string
+
+	// retired keys are still trusted for this long, so tokens they signed can expire naturally
+	retiredKeyValidTime time.Duration
+}
+
+func newKeyring(entry keyringEntry, retiredKeyValidTime time.Duration) *keyring {
+	k := &keyring{
+		entries:             make(map[string]*keyringEntry),
+		activeKid:           entry.kid,
+		defaultKid:          entry.kid,
+		retiredKeyValidTime: retiredKeyValidTime,
+	}
+
+	// servers that fetch their keys from a jwks start with an empty keyring
+	if entry.verifyKey != nil {
+		k.entries[entry.kid] = &entry
+	}
+
+	return k
+}
+
+func (k *keyring) add(kid string, signKey interface{}, verifyKey interface{}) error {
+	if verifyKey == nil {
+		return errors.New("a verify key is required")
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.pruneLocked(time.Now())
+	if _, ok := k.entries[kid]; ok {
+		return errors.New("a key with this kid is already in the keyring")
+	}
+
+	k.entries[kid] = &keyringEntry{
+		kid:       kid,
+		signKey:   signKey,
+		verifyKey: verifyKey,
+	}
+
+	return nil
+}
+
+func (k *keyring) promote(kid string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.pruneLocked(time.Now())
+	entry, ok := k.entries[kid]
+	if !ok {
+		return errors.New("no key with this kid in the keyring")
+	}
+	if entry.signKey == nil {
+		return errors.New("key has no sign key and cannot be promoted")
+	}
+
+	entry.retiredAt = time.Time{}
+	k.activeKid = kid
+
+	return nil
+}
+
+func (k *keyring) retire(kid string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := time.Now()
+	k.pruneLocked(now)
+	entry, ok := k.entries[kid]
+	if !ok {
+		return errors.New("no key with this kid in the keyring")
+	}
+	if kid == k.activeKid {
+		return errors.New("cannot retire the active signing key; promote another key first")
+	}
+
+	if entry.retiredAt.IsZero() {
+		entry.retiredAt = now
+	}
+
+	return nil
+}
+
+func (k *keyring) remove(kid string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.entries[kid]; !ok {
+		return errors.New("no key with this kid in the keyring")
+	}
+	if kid == k.activeKid {
+		return errors.New("cannot remove the active signing key; promote another key first")
+	}
+
+	delete(k.entries, kid)
+
+	return nil
+}
+
+// swap : make the given key pair the active one in a single step, so no request can see a
+// half updated pair. If the kid changes, the previous active key is retired, and tokens it
+// signed keep verifying until they expire. If it doesn't, the key it replaces is kept along
+// with it, for as long as a retired key would be.
+func (k *keyring) swap(entry keyringEntry) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := time.Now()
+	k.pruneLocked(now)
+	if previous, ok := k.entries[k.activeKid]; ok && k.activeKid != entry.kid && previous.retiredAt.IsZero() {
+		previous.retiredAt = now
+	}
+
+	if replaced, ok := k.entries[entry.kid]; ok && !sameKey(replaced.verifyKey, entry.verifyKey) {
+		superseded := *replaced
+		superseded.superseded = nil
+		if superseded.retiredAt.IsZero() {
+			superseded.retiredAt = now
+		}
+		entry.superseded = append([]keyringEntry{superseded}, k.supersededLocked(replaced, now)...)
+	}
+
+	k.entries[entry.kid] = &entry
+	k.activeKid = entry.kid
+}
+
+// update : replace every key in a single step with the given ones, e.g. to follow a rotation
+// schedule
+func (k *keyring) update(entries []keyringEntry, activeKid string) {
+	updated := make(map[string]*keyringEntry, len(entries))
+	for i := range entries {
+		entry := entries[i]
+		updated[entry.kid] = &entry
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.entries = updated
+	k.activeKid = activeKid
+}
+
+func (k *keyring) activeKeyID() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.activeKid
+}
+
+// signingEntry : returns the active key pair. The entry is never mutated in place
+// so callers can safely use it after the lock is released.
+func (k *keyring) signingEntry() (keyringEntry, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	entry, ok := k.entries[k.activeKid]
+	if !ok || entry.signKey == nil {
+		return keyringEntry{}, errors.New("no signing key available")
+	}
+
+	return *entry, nil
+}
+
+func (k *keyring) verifyKeyForToken(token *jwtGo.Token) (interface{}, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	kid := k.defaultKid
+	if headerKid, ok := token.Header["kid"]; ok {
+		kid, ok = headerKid.(string)
+		if !ok {
+			return nil, errors.New("kid in token header is not a string")
+		}
+	}
+
+	now := time.Now()
+	entry, ok := k.entries[kid]
+	if !ok || k.isExpiredLocked(entry, now) {
+		return nil, errors.New("no verify key found for the kid in the token header")
+	}
+
+	// a certificate is only trusted within its validity window
+	if len(entry.certificates) > 0 {
+		if err := checkCertificateValidity(entry.certificates[0], now); err != nil {
+			return nil, err
+		}
+	}
+
+	superseded := k.supersededLocked(entry, now)
+	if len(superseded) == 0 {
+		return entry.verifyKey, nil
+	}
+
+	// the token may have been signed before the key was reloaded
+	keys := jwtGo.VerificationKeySet{Keys: []jwtGo.VerificationKey{entry.verifyKey}}
+	for _, previous := range superseded {
+		if len(previous.certificates) > 0 && checkCertificateValidity(previous.certificates[0], now) != nil {
+			continue
+		}
+		keys.Keys = append(keys.Keys, previous.verifyKey)
+	}
+
+	return keys, nil
+}
+
+// supersededLocked : the keys replaced under the kid of entry that are still trusted
+func (k *keyring) supersededLocked(entry *keyringEntry, now time.Time) []keyringEntry {
+	var superseded []keyringEntry
+	for i := range entry.superseded {
+		if !k.isExpiredLocked(&entry.superseded[i], now) {
+			superseded = append(superseded, entry.superseded[i])
+		}
+	}
+
+	return superseded
+}
+
+// verifyEntries : a snapshot of every key that is currently trusted for verification
+func (k *keyring) verifyEntries() []keyringEntry {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	now := time.Now()
+	entries := make([]keyringEntry, 0, len(k.entries))
+	for _, entry := range k.entries {
+		if !k.isExpiredLocked(entry, now) {
+			entries = append(entries, *entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].kid < entries[j].kid })
+
+	return entries
+}
+
+func (k *keyring) isExpiredLocked(entry *keyringEntry, now time.Time) bool {
+	return !entry.retiredAt.IsZero() && now.After(entry.retiredAt.Add(k.retiredKeyValidTime))
+}
+
+func (k *keyring) pruneLocked(now time.Time) {
+	for kid, entry := range k.entries {
+		if k.isExpiredLocked(entry, now) {
+			delete(k.entries, kid)
+		}
+	}
+}
+
+// checkKeyTypes : make sure keys added at runtime can be used with the configured signing method
+func checkKeyTypes(signingMethodString string, signKey interface{}, verifyKey interface{}) error {
+	var signOk, verifyOk bool
+
+	switch signingMethodString {
+	case "HS256", "HS384", "HS512":
+		_, signOk = signKey.([]byte)
+		_, verifyOk = verifyKey.([]byte)
+	case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+		_, signOk = signKey.(*rsa.PrivateKey)
+		_, verifyOk = verifyKey.(*rsa.PublicKey)
+	case "ES256", "ES384", "ES512":
+		_, signOk = signKey.(*ecdsa.PrivateKey)
+		_, verifyOk = verifyKey.(*ecdsa.PublicKey)
+	case "EdDSA":
+		_, signOk = signKey.(ed25519.PrivateKey)
+		_, verifyOk = verifyKey.(ed25519.PublicKey)
+	default:
+		return errors.New("signing method string not recognized")
+	}
+
+	if signKey != nil && !signOk {
+		// keys held outside of the process (e.g. in a KMS) sign through crypto.Signer
+		if signer, ok := signKey.(crypto.Signer); ok && !isHMACSigningMethod(signingMethodString) {
+			signOk = checkKeyTypes(signingMethodString, nil, signer.Public()) == nil
+		}
+	}
+	if signKey != nil && !signOk {
+		return errors.New("sign key type does not match the signing method")
+	}
+	if !verifyOk {
+		return errors.New("verify key type does not match the signing method")
+	}
+
+	return nil
+}
+
+// signingMethodKeyType : the type of key used by a signing method, or "" if the
+// signing method isn't recognized
+func signingMethodKeyType(signingMethodString string) string {
+	switch signingMethodString {
+	case "HS256", "HS384", "HS512":
+		return "hmac"
+	case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+		return "rsa"
+	case "ES256", "ES384", "ES512":
+		return "ecdsa"
+	case "EdDSA":
+		return "ed25519"
+	}
+
+	return ""
+}
+
+// AddKey : add a key pair to the keyring under the given kid. The key is trusted for
+// verification straight away, but is not used for signing until it is promoted.
+// signKey may be nil for keys that should only ever be used to verify tokens.
+func (a *Auth) AddKey(kid string, signKey interface{}, verifyKey interface{}) error {
+	if err := checkKeyTypes(a.options.SigningMethodString, signKey, verifyKey); err != nil {
+		return err
+	}
+
+	return a.keys.add(kid, signKey, verifyKey)
+}
+
+// PromoteKey : make the key with the given kid the active signing key
+func (a *Auth) PromoteKey(kid string) error {
+	return a.keys.promote(kid)
+}
+
+// RetireKey : stop trusting the key once every token it could have signed has expired,
+// i.e. after RefreshTokenValidTime. The active signing key cannot be retired.
+func (a *Auth) RetireKey(kid string) error {
+	return a.keys.retire(kid)
+}
+
+// RemoveKey : immediately stop trusting the key with the given kid (e.g. if it was compromised)
+func (a *Auth) RemoveKey(kid string) error {
+	return a.keys.remove(kid)
+}
+
+// ActiveKeyID : the kid of the key currently used for signing
+func (a *Auth) ActiveKeyID() string {
+	return a.keys.activeKeyID()
+}
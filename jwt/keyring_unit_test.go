@@ -0,0 +1,168 @@
+package jwt
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
+)
+
+func TestKeyRotation(t *testing.T) {
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString:   "HS256",
+		KeyID:                 "key-1",
+		HMACKey:               []byte("first test key"),
+		RefreshTokenValidTime: 72 * time.Hour,
+		AuthTokenValidTime:    15 * time.Minute,
+		Debug:                 false,
+		IsDevEnv:              true,
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+
+	var c credentials
+	var claims ClaimsType
+	claims.CustomClaims = make(map[string]interface{})
+	claims.CustomClaims["foo"] = "bar"
+
+	err := a.buildCredentialsFromClaims(&c, &claims)
+	if err != nil {
+		t.Errorf("Unable to build credentials; Err: %v", err)
+	}
+	oldTokenString, signErr := a.signToken(c.AuthToken.Token)
+	if signErr != nil {
+		t.Errorf("Unable to sign auth token; Err: %v", signErr)
+	}
+	if c.AuthToken.Token.Header["kid"] != "key-1" {
+		t.Errorf("Expected kid key-1 in token header; Received: %v", c.AuthToken.Token.Header["kid"])
+	}
+
+	// add and promote a new key
+	if err := a.AddKey("key-2", []byte("second test key"), []byte("second test key")); err != nil {
+		t.Errorf("Unable to add key; Err: %v", err)
+	}
+	if err := a.AddKey("key-2", []byte("second test key"), []byte("second test key")); err == nil {
+		t.Error("Expected an error when adding a duplicate kid")
+	}
+	if err := a.PromoteKey("key-2"); err != nil {
+		t.Errorf("Unable to promote key; Err: %v", err)
+	}
+	if a.ActiveKeyID() != "key-2" {
+		t.Errorf("Active key was not promoted; Expected: key-2; Received: %s", a.ActiveKeyID())
+	}
+
+	err = a.buildCredentialsFromClaims(&c, &claims)
+	if err != nil {
+		t.Errorf("Unable to build credentials; Err: %v", err)
+	}
+	newTokenString, signErr := a.signToken(c.AuthToken.Token)
+	if signErr != nil {
+		t.Errorf("Unable to sign auth token; Err: %v", signErr)
+	}
+	if c.AuthToken.Token.Header["kid"] != "key-2" {
+		t.Errorf("Expected kid key-2 in token header; Received: %v", c.AuthToken.Token.Header["kid"])
+	}
+
+	// retired keys keep verifying the tokens they signed
+	if err := a.RetireKey("key-2"); err == nil {
+		t.Error("Expected an error when retiring the active key")
+	}
+	if err := a.RetireKey("key-1"); err != nil {
+		t.Errorf("Unable to retire key; Err: %v", err)
+	}
+
+	for _, tokenString := range []string{oldTokenString, newTokenString} {
+		var verify credentials
+		if err := a.buildCredentialsFromStrings(c.CsrfString, tokenString, "", &verify); err != nil {
+			t.Errorf("Unable to build credentials; Err: %v", err)
+		}
+		if verify.AuthToken.ParseErr != nil || !verify.AuthToken.Token.Valid {
+			t.Errorf("Expected token to verify after rotation; Err: %v", verify.AuthToken.ParseErr)
+		}
+	}
+
+	// ...until every token they could have signed has expired
+	a.keys.retiredKeyValidTime = 0
+	time.Sleep(time.Millisecond)
+
+	var verify credentials
+	if err := a.buildCredentialsFromStrings(c.CsrfString, oldTokenString, "", &verify); err != nil {
+		t.Errorf("Unable to build credentials; Err: %v", err)
+	}
+	if verify.AuthToken.ParseErr == nil {
+		t.Error("Expected token signed with an expired retired key to fail verification")
+	}
+
+	if err := a.RemoveKey("key-2"); err == nil {
+		t.Error("Expected an error when removing the active key")
+	}
+	if err := a.PromoteKey("unknown"); err == nil {
+		t.Error("Expected an error when promoting an unknown key")
+	}
+}
+
+func TestRemoveKey(t *testing.T) {
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString: "RS256",
+		PrivateKeyLocation:  "test/priv.rsa",
+		PublicKeyLocation:   "test/priv.rsa.pub",
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+
+	var c credentials
+	var claims ClaimsType
+	err := a.buildCredentialsFromClaims(&c, &claims)
+	if err != nil {
+		t.Errorf("Unable to build credentials; Err: %v", err)
+	}
+	tokenString, signErr := a.signToken(c.AuthToken.Token)
+	if signErr != nil {
+		t.Errorf("Unable to sign auth token; Err: %v", signErr)
+	}
+	initialKid := a.ActiveKeyID()
+	if initialKid == "" || c.AuthToken.Token.Header["kid"] != initialKid {
+		t.Errorf("Expected the key thumbprint as kid when no KeyID is configured; Received: %v", c.AuthToken.Token.Header["kid"])
+	}
+
+	signBytes, readErr := ioutil.ReadFile("test/priv.rsa")
+	if readErr != nil {
+		t.Fatalf("Unable to read RSA private key file: %v", readErr)
+	}
+	signKey, parseErr := jwtGo.ParseRSAPrivateKeyFromPEM(signBytes)
+	if parseErr != nil {
+		t.Fatalf("Unable to parse RSA private key: %v", parseErr)
+	}
+
+	if err := a.AddKey("ec", nil, []byte("wrong key type")); err == nil {
+		t.Error("Expected an error when adding a key that does not match the signing method")
+	}
+	if err := a.AddKey("verify-only", nil, &signKey.PublicKey); err != nil {
+		t.Errorf("Unable to add verify only key; Err: %v", err)
+	}
+	if err := a.PromoteKey("verify-only"); err == nil {
+		t.Error("Expected an error when promoting a key without a sign key")
+	}
+	if err := a.AddKey("next", signKey, &signKey.PublicKey); err != nil {
+		t.Errorf("Unable to add key; Err: %v", err)
+	}
+	if err := a.PromoteKey("next"); err != nil {
+		t.Errorf("Unable to promote key; Err: %v", err)
+	}
+	if err := a.RemoveKey(initialKid); err != nil {
+		t.Errorf("Unable to remove key; Err: %v", err)
+	}
+
+	var verify credentials
+	if err := a.buildCredentialsFromStrings(c.CsrfString, tokenString, "", &verify); err != nil {
+		t.Errorf("Unable to build credentials; Err: %v", err)
+	}
+	if verify.AuthToken.ParseErr == nil {
+		t.Error("Expected token signed with a removed key to fail verification")
+	}
+}
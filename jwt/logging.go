@@ -0,0 +1,131 @@
+package jwt
+
+import (
+	"context"
+	"log/slog"
+	"os"
+)
+
+// redactedValue : what's logged instead of a secret
+const redactedValue = "[redacted]"
+
+// secretLogKeys : the fields of the log events that hold raw tokens or csrf strings
+var secretLogKeys = map[string]bool{
+	"token":         true,
+	"auth_token":    true,
+	"refresh_token": true,
+	"csrf":          true,
+}
+
+// newLogger : the logger of the options, or one that discards everything. Debug logs everything to
+// stderr when there's no logger. Secrets are redacted unless LogSecrets is set.
+func newLogger(o *Options) *slog.Logger {
+	logger := o.Logger
+	if logger == nil {
+		if !o.Debug {
+			return slog.New(discardHandler{})
+		}
+		logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+	if o.LogSecrets {
+		return logger
+	}
+
+	return slog.New(&redactingHandler{handler: logger.Handler()})
+}
+
+// log : the logger of the Auth
+func (a *Auth) log() *slog.Logger {
+	if a.logger == nil {
+		return defaultLogger()
+	}
+	return a.logger
+}
+
+// defaultLogger : the logger of an Auth, credentials or token that wasn't built by New
+func defaultLogger() *slog.Logger {
+	return newLogger(&Options{})
+}
+
+// discardHandler : drops every event, for when there's no logger
+type discardHandler struct{}
+
+func (h discardHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return false
+}
+
+func (h discardHandler) Handle(ctx context.Context, record slog.Record) error {
+	return nil
+}
+
+func (h discardHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h
+}
+
+func (h discardHandler) WithGroup(name string) slog.Handler {
+	return h
+}
+
+// redactingHandler : replaces the values of the secret fields before they reach the handler
+type redactingHandler struct {
+	handler slog.Handler
+}
+
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(attr))
+		return true
+	})
+
+	return h.handler.Handle(ctx, redacted)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redacted[i] = redactAttr(attr)
+	}
+
+	return &redactingHandler{handler: h.handler.WithAttrs(redacted)}
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{handler: h.handler.WithGroup(name)}
+}
+
+// redactAttr : the attribute, with the values of secret fields redacted, in groups too
+func redactAttr(attr slog.Attr) slog.Attr {
+	if secretLogKeys[attr.Key] {
+		return slog.String(attr.Key, redactedValue)
+	}
+
+	value := attr.Value.Resolve()
+	if value.Kind() != slog.KindGroup {
+		return attr
+	}
+	group := value.Group()
+	redacted := make([]any, len(group))
+	for i, groupAttr := range group {
+		redacted[i] = redactAttr(groupAttr)
+	}
+
+	return slog.Group(attr.Key, redacted...)
+}
+
+// tokenLogAttrs : the fields of the log events about a token
+func tokenLogAttrs(token *jwtToken) []any {
+	if token == nil || token.Token == nil {
+		return nil
+	}
+	claims, ok := token.Token.Claims.(*ClaimsType)
+	if !ok {
+		return nil
+	}
+
+	return []any{"uid", claims.UID, "jti", claims.ID, "token_use", claims.TokenUse}
+}
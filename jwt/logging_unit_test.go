@@ -0,0 +1,142 @@
+package jwt
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogging(t *testing.T) {
+	var tests = []struct {
+		name       string
+		logSecrets bool
+	}{
+		{"redacted", false},
+		{"secrets", true},
+	}
+
+	for _, test := range tests {
+		var logs bytes.Buffer
+		var a Auth
+		authErr := New(&a, Options{
+			SigningMethodString: "HS256",
+			HMACKey:             []byte("test key"),
+			BearerTokens:        true,
+			Logger:              slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+			LogSecrets:          test.logSecrets,
+		})
+		if authErr != nil {
+			t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+		}
+
+		claims := ClaimsType{UID: "user id"}
+		w := httptest.NewRecorder()
+		if err := a.IssueNewTokens(w, &claims); err != nil {
+			t.Fatalf("[%s] Unable to issue tokens; Err: %v", test.name, err)
+		}
+
+		req, reqErr := http.NewRequest("GET", "http://localhost:8080/restricted", nil)
+		if reqErr != nil {
+			t.Fatalf("Error building request for testing; err: %v", reqErr)
+		}
+		req.Header.Set(a.options.AuthTokenName, w.Header().Get(a.options.AuthTokenName))
+		req.Header.Set(a.options.RefreshTokenName, w.Header().Get(a.options.RefreshTokenName))
+		req.Header.Set(a.options.CSRFTokenName, "wrong csrf string")
+		a.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(httptest.NewRecorder(), req)
+
+		events := make(map[string]map[string]interface{})
+		for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+			var event map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &event); err != nil {
+				t.Fatalf("[%s] Unable to decode log event; Err: %v", test.name, err)
+			}
+			events[event["msg"].(string)] = event
+		}
+
+		refused, ok := events["request refused"]
+		if !ok || refused["reason"] != "csrf_mismatch" || refused["path"] != "/restricted" || refused["level"] != "DEBUG" {
+			t.Errorf("[%s] Expected a structured event for the refused request; Received: %v", test.name, refused)
+		}
+
+		mismatch := events["csrf string doesn't match the auth token"]
+		if mismatch["uid"] != "user id" || mismatch["jti"] == "" || mismatch["token_use"] != tokenUseAccess {
+			t.Errorf("[%s] Expected the fields of the auth token; Received: %v", test.name, mismatch)
+		}
+
+		expectedCsrf := redactedValue
+		if test.logSecrets {
+			expectedCsrf = "wrong csrf string"
+		}
+		if mismatch["csrf"] != expectedCsrf {
+			t.Errorf("[%s] Expected csrf %q; Received: %v", test.name, expectedCsrf, mismatch["csrf"])
+		}
+		if !test.logSecrets && strings.Contains(logs.String(), "wrong csrf string") {
+			t.Errorf("[%s] Expected no secrets in the logs; Received: %s", test.name, logs.String())
+		}
+	}
+}
+
+func TestLoggingWithoutLogger(t *testing.T) {
+	var logs bytes.Buffer
+	previousLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer slog.SetDefault(previousLogger)
+
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString: "HS256",
+		HMACKey:             []byte("test key"),
+		BearerTokens:        true,
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+
+	// nothing reaches the default logger of the application
+	req, reqErr := http.NewRequest("GET", "http://localhost:8080/restricted", nil)
+	if reqErr != nil {
+		t.Fatalf("Error building request for testing; err: %v", reqErr)
+	}
+	req.Header.Set(a.options.AuthTokenName, "not a token")
+	a.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(httptest.NewRecorder(), req)
+	a.log().Error("internal error")
+
+	if logs.Len() != 0 {
+		t.Errorf("Expected nothing to be logged without a logger; Received: %s", logs.String())
+	}
+}
+
+func TestRedactingHandler(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(&redactingHandler{handler: slog.NewJSONHandler(&logs, nil)})
+
+	logger.With("auth_token", "raw auth token").WithGroup("request").Info("event",
+		"path", "/",
+		slog.Group("tokens", "refresh_token", "raw refresh token", "jti", "token id"),
+	)
+
+	var event struct {
+		AuthToken string `json:"auth_token"`
+		Request   struct {
+			Path   string `json:"path"`
+			Tokens struct {
+				RefreshToken string `json:"refresh_token"`
+				Jti          string `json:"jti"`
+			} `json:"tokens"`
+		} `json:"request"`
+	}
+	if err := json.Unmarshal(logs.Bytes(), &event); err != nil {
+		t.Fatalf("Unable to decode log event; Err: %v", err)
+	}
+
+	if event.AuthToken != redactedValue || event.Request.Tokens.RefreshToken != redactedValue {
+		t.Errorf("Expected the tokens to be redacted; Received: %s", logs.String())
+	}
+	if event.Request.Path != "/" || event.Request.Tokens.Jti != "token id" {
+		t.Errorf("Expected the other fields to be kept; Received: %s", logs.String())
+	}
+}
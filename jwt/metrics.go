@@ -0,0 +1,210 @@
+package jwt
+
+import (
+	"encoding/json"
+	"expvar"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// outcomeAuthorized : the outcome of the requests that passed the middleware. Refused requests
+// are counted by the reason code of their error.
+const outcomeAuthorized = "authorized"
+
+// Metrics : receives the measurements of the middleware
+type Metrics interface {
+	// RequestProcessed : a request was checked; outcome is "authorized" or the reason code
+	// of the error it was refused with, e.g. "csrf_mismatch"
+	RequestProcessed(outcome string)
+	// TokensRefreshed : new tokens were issued for a valid refresh token
+	TokensRefreshed()
+	// TokenSigned : how long encoding (and signing) a token took
+	TokenSigned(duration time.Duration)
+	// TokenVerified : how long decoding (and verifying) a token took
+	TokenVerified(duration time.Duration)
+	// RevocationChecked : how long checking that a refresh token has not been revoked took
+	RevocationChecked(duration time.Duration)
+}
+
+// noopMetrics : the metrics of an Auth without Options.Metrics
+type noopMetrics struct{}
+
+func (noopMetrics) RequestProcessed(outcome string)          {}
+func (noopMetrics) TokensRefreshed()                         {}
+func (noopMetrics) TokenSigned(duration time.Duration)       {}
+func (noopMetrics) TokenVerified(duration time.Duration)     {}
+func (noopMetrics) RevocationChecked(duration time.Duration) {}
+
+// metrics : the metrics of the Auth
+func (a *Auth) metrics() Metrics {
+	if a.options.Metrics == nil {
+		return noopMetrics{}
+	}
+	return a.options.Metrics
+}
+
+// latencyBuckets : the upper bounds, in seconds, of the latency histograms
+var latencyBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// ExpvarMetrics : metrics published with expvar, e.g. on /debug/vars
+type ExpvarMetrics struct {
+	outcomes          *expvar.Map
+	refreshes         *expvar.Int
+	signLatency       *expvarHistogram
+	verifyLatency     *expvarHistogram
+	revocationLatency *expvarHistogram
+}
+
+// NewExpvarMetrics : metrics published as an expvar map under name. An existing map of
+// ExpvarMetrics under the same name is reused, so several Auths can share it.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	vars, ok := expvar.Get(name).(*expvar.Map)
+	if !ok {
+		vars = expvar.NewMap(name)
+	}
+
+	return &ExpvarMetrics{
+		outcomes:          expvarVar(vars, "outcomes", func() *expvar.Map { return new(expvar.Map) }),
+		refreshes:         expvarVar(vars, "refreshes", func() *expvar.Int { return new(expvar.Int) }),
+		signLatency:       expvarVar(vars, "sign_seconds", newExpvarHistogram),
+		verifyLatency:     expvarVar(vars, "verify_seconds", newExpvarHistogram),
+		revocationLatency: expvarVar(vars, "revocation_check_seconds", newExpvarHistogram),
+	}
+}
+
+// expvarVar : the variable of the map under key, added if it's not there yet
+func expvarVar[T expvar.Var](vars *expvar.Map, key string, newVar func() T) T {
+	if existing, ok := vars.Get(key).(T); ok {
+		return existing
+	}
+
+	v := newVar()
+	vars.Set(key, v)
+	return v
+}
+
+func (m *ExpvarMetrics) RequestProcessed(outcome string) {
+	m.outcomes.Add(outcome, 1)
+}
+
+func (m *ExpvarMetrics) TokensRefreshed() {
+	m.refreshes.Add(1)
+}
+
+func (m *ExpvarMetrics) TokenSigned(duration time.Duration) {
+	m.signLatency.observe(duration.Seconds())
+}
+
+func (m *ExpvarMetrics) TokenVerified(duration time.Duration) {
+	m.verifyLatency.observe(duration.Seconds())
+}
+
+func (m *ExpvarMetrics) RevocationChecked(duration time.Duration) {
+	m.revocationLatency.observe(duration.Seconds())
+}
+
+// expvarHistogram : a histogram with cumulative buckets, published as
+// {"count": n, "sum": s, "buckets": {"0.001": n, ...}}
+type expvarHistogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func newExpvarHistogram() *expvarHistogram {
+	return &expvarHistogram{
+		buckets: latencyBuckets,
+		counts:  make([]uint64, len(latencyBuckets)),
+	}
+}
+
+func (h *expvarHistogram) observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.count++
+	h.sum += value
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+}
+
+// String : the json of the histogram, as expvar.Var requires
+func (h *expvarHistogram) String() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	buckets := make(map[string]uint64, len(h.buckets))
+	for i, bound := range h.buckets {
+		buckets[strconv.FormatFloat(bound, 'g', -1, 64)] = h.counts[i]
+	}
+
+	encoded, _ := json.Marshal(struct {
+		Count   uint64            `json:"count"`
+		Sum     float64           `json:"sum"`
+		Buckets map[string]uint64 `json:"buckets"`
+	}{h.count, h.sum, buckets})
+	return string(encoded)
+}
+
+// MetricsRegistry : a Prometheus-style registry of labeled counters and histograms. Wrap
+// e.g. a prometheus.Registerer to record the metrics of the middleware in it.
+type MetricsRegistry interface {
+	NewCounterVec(name string, help string, labelNames []string) CounterVec
+	NewHistogramVec(name string, help string, buckets []float64, labelNames []string) HistogramVec
+}
+
+// CounterVec : a counter partitioned by the values of its labels
+type CounterVec interface {
+	Add(value float64, labelValues ...string)
+}
+
+// HistogramVec : a histogram partitioned by the values of its labels
+type HistogramVec interface {
+	Observe(value float64, labelValues ...string)
+}
+
+// RegistryMetrics : metrics recorded in a MetricsRegistry
+type RegistryMetrics struct {
+	requests          CounterVec
+	refreshes         CounterVec
+	signLatency       HistogramVec
+	verifyLatency     HistogramVec
+	revocationLatency HistogramVec
+}
+
+// NewRegistryMetrics : registers the metrics of the middleware, named jwt_auth_*
+func NewRegistryMetrics(registry MetricsRegistry) *RegistryMetrics {
+	return &RegistryMetrics{
+		requests:          registry.NewCounterVec("jwt_auth_requests_total", "Requests checked by the middleware, by outcome.", []string{"outcome"}),
+		refreshes:         registry.NewCounterVec("jwt_auth_refreshes_total", "Tokens refreshed with a valid refresh token.", nil),
+		signLatency:       registry.NewHistogramVec("jwt_auth_sign_duration_seconds", "Time taken to encode and sign a token.", latencyBuckets, nil),
+		verifyLatency:     registry.NewHistogramVec("jwt_auth_verify_duration_seconds", "Time taken to decode and verify a token.", latencyBuckets, nil),
+		revocationLatency: registry.NewHistogramVec("jwt_auth_revocation_check_duration_seconds", "Time taken to check that a refresh token has not been revoked.", latencyBuckets, nil),
+	}
+}
+
+func (m *RegistryMetrics) RequestProcessed(outcome string) {
+	m.requests.Add(1, outcome)
+}
+
+func (m *RegistryMetrics) TokensRefreshed() {
+	m.refreshes.Add(1)
+}
+
+func (m *RegistryMetrics) TokenSigned(duration time.Duration) {
+	m.signLatency.Observe(duration.Seconds())
+}
+
+func (m *RegistryMetrics) TokenVerified(duration time.Duration) {
+	m.verifyLatency.Observe(duration.Seconds())
+}
+
+func (m *RegistryMetrics) RevocationChecked(duration time.Duration) {
+	m.revocationLatency.Observe(duration.Seconds())
+}
@@ -0,0 +1,157 @@
+package jwt
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
+)
+
+// testRegistry : an in-process MetricsRegistry
+type testRegistry struct {
+	mu         sync.Mutex
+	counters   map[string]float64
+	histograms map[string][]float64
+}
+
+type testCounterVec struct {
+	registry *testRegistry
+	name     string
+}
+
+type testHistogramVec struct {
+	registry *testRegistry
+	name     string
+}
+
+func newTestRegistry() *testRegistry {
+	return &testRegistry{
+		counters:   make(map[string]float64),
+		histograms: make(map[string][]float64),
+	}
+}
+
+// series : the name of a metric with its label values, e.g. jwt_auth_requests_total{authorized}
+func series(name string, labelValues []string) string {
+	return name + "{" + strings.Join(labelValues, ",") + "}"
+}
+
+func (r *testRegistry) NewCounterVec(name string, help string, labelNames []string) CounterVec {
+	return &testCounterVec{registry: r, name: name}
+}
+
+func (r *testRegistry) NewHistogramVec(name string, help string, buckets []float64, labelNames []string) HistogramVec {
+	return &testHistogramVec{registry: r, name: name}
+}
+
+func (c *testCounterVec) Add(value float64, labelValues ...string) {
+	c.registry.mu.Lock()
+	defer c.registry.mu.Unlock()
+	c.registry.counters[series(c.name, labelValues)] += value
+}
+
+func (h *testHistogramVec) Observe(value float64, labelValues ...string) {
+	h.registry.mu.Lock()
+	defer h.registry.mu.Unlock()
+	key := series(h.name, labelValues)
+	h.registry.histograms[key] = append(h.registry.histograms[key], value)
+}
+
+func TestRegistryMetrics(t *testing.T) {
+	registry := newTestRegistry()
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString: "HS256",
+		HMACKey:             []byte("test key"),
+		BearerTokens:        true,
+		UpdateTokenClaims:   func(claims *ClaimsType) ClaimsType { return *claims },
+		Metrics:             NewRegistryMetrics(registry),
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+
+	w := httptest.NewRecorder()
+	if err := a.IssueNewTokens(w, &ClaimsType{}); err != nil {
+		t.Fatalf("Unable to issue tokens; Err: %v", err)
+	}
+	csrf := w.Header().Get(a.options.CSRFTokenName)
+
+	expiredClaims := ClaimsType{Csrf: csrf, TokenUse: tokenUseAccess}
+	expiredClaims.ExpiresAt = jwtGo.NewNumericDate(time.Now().Add(-time.Minute))
+	expiredAuthTokenString, err := a.encodeToken(newAuthTokenWithClaims(jwtGo.SigningMethodHS256, &expiredClaims))
+	if err != nil {
+		t.Fatalf("Unable to sign auth token; Err: %v", err)
+	}
+
+	newRequest := func(authTokenString string, csrf string) *http.Request {
+		req, reqErr := http.NewRequest("GET", "http://localhost:8080/", nil)
+		if reqErr != nil {
+			t.Fatalf("Error building request for testing; err: %v", reqErr)
+		}
+		req.Header.Set(a.options.AuthTokenName, authTokenString)
+		req.Header.Set(a.options.RefreshTokenName, w.Header().Get(a.options.RefreshTokenName))
+		req.Header.Set(a.options.CSRFTokenName, csrf)
+		return req
+	}
+
+	handler := a.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest(w.Header().Get(a.options.AuthTokenName), csrf))
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest(expiredAuthTokenString, csrf))
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest(w.Header().Get(a.options.AuthTokenName), "wrong csrf string"))
+
+	var counterTests = []struct {
+		series   string
+		expected float64
+	}{
+		{"jwt_auth_requests_total{authorized}", 2},
+		{"jwt_auth_requests_total{csrf_mismatch}", 1},
+		{"jwt_auth_refreshes_total{}", 1},
+	}
+	for _, test := range counterTests {
+		if registry.counters[test.series] != test.expected {
+			t.Errorf("Expected %s to be %v; Received: %v", test.series, test.expected, registry.counters[test.series])
+		}
+	}
+
+	for _, name := range []string{"jwt_auth_sign_duration_seconds{}", "jwt_auth_verify_duration_seconds{}", "jwt_auth_revocation_check_duration_seconds{}"} {
+		if len(registry.histograms[name]) == 0 {
+			t.Errorf("Expected observations of %s", name)
+		}
+	}
+}
+
+func TestExpvarMetrics(t *testing.T) {
+	metrics := NewExpvarMetrics("jwt_auth_test")
+	metrics.RequestProcessed(outcomeAuthorized)
+	metrics.TokensRefreshed()
+	metrics.TokenSigned(2 * time.Millisecond)
+
+	// a second instance shares the published variables
+	NewExpvarMetrics("jwt_auth_test").RequestProcessed(outcomeAuthorized)
+
+	var published struct {
+		Outcomes    map[string]int `json:"outcomes"`
+		Refreshes   int            `json:"refreshes"`
+		SignSeconds struct {
+			Count   int            `json:"count"`
+			Buckets map[string]int `json:"buckets"`
+		} `json:"sign_seconds"`
+	}
+	if err := json.Unmarshal([]byte(expvar.Get("jwt_auth_test").String()), &published); err != nil {
+		t.Fatalf("Unable to decode expvar metrics; Err: %v", err)
+	}
+
+	if published.Outcomes[outcomeAuthorized] < 2 || published.Refreshes < 1 {
+		t.Errorf("Expected the counters to be published; Received: %+v", published)
+	}
+	if published.SignSeconds.Count < 1 || published.SignSeconds.Buckets["0.0025"] < 1 || published.SignSeconds.Buckets["0.001"] != 0 {
+		t.Errorf("Expected the latency in the 0.0025 bucket; Received: %+v", published.SignSeconds)
+	}
+}
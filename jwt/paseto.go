@@ -0,0 +1,365 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+)
+
+const (
+	pasetoV4Public = "v4.public"
+	pasetoV4Local  = "v4.local"
+
+	pasetoLocalKeySize = 32
+)
+
+// errPasetoInvalid : the same error for every verification failure, so they can't be told apart
+var errPasetoInvalid = errors.New("invalid paseto token")
+
+// pasetoCodec : tokens as PASETO v4 (https://github.com/paseto-standard/paseto-spec). v4.public
+// tokens are signed with the Ed25519 keys of the EdDSA signing method, and v4.local tokens are
+// encrypted with a 32 byte symmetric key, held like an HMAC key. The kid is carried in the footer.
+type pasetoCodec struct {
+	purpose             string
+	parserOptions       []jwtGo.ParserOption
+	flattenCustomClaims bool
+}
+
+type pasetoFooter struct {
+	Kid string `json:"kid,omitempty"`
+}
+
+func (c *pasetoCodec) header() string {
+	return c.purpose + "."
+}
+
+// signingMethodString : the signing method whose keys the purpose uses
+func (c *pasetoCodec) signingMethodString() string {
+	if c.purpose == pasetoV4Public {
+		return "EdDSA"
+	}
+
+	return "HS256"
+}
+
+func (c *pasetoCodec) encode(token *jwtGo.Token, entry keyringEntry) (string, error) {
+	claims, ok := token.Claims.(*ClaimsType)
+	if !ok {
+		return "", errors.New("cannot read token claims")
+	}
+	message, err := encodePasetoClaims(claims)
+	if err != nil {
+		return "", err
+	}
+
+	var footer []byte
+	if entry.kid != "" {
+		footer, err = json.Marshal(pasetoFooter{Kid: entry.kid})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var payload []byte
+	if c.purpose == pasetoV4Public {
+		signKey, ok := entry.signKey.(ed25519.PrivateKey)
+		if !ok {
+			return "", errors.New("v4.public tokens require an Ed25519 private key")
+		}
+
+		// https://github.com/paseto-standard/paseto-spec/blob/master/docs/01-Protocol-Versions/Version4.md#sign
+		signature := ed25519.Sign(signKey, pasetoPAE([]byte(c.header()), message, footer, nil))
+		payload = append(message, signature...)
+	} else {
+		key, ok := entry.signKey.([]byte)
+		if !ok || len(key) != pasetoLocalKeySize {
+			return "", errors.New("v4.local tokens require a 32 byte key")
+		}
+
+		nonce := make([]byte, 32)
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+		payload, err = pasetoLocalEncrypt(key, nonce, []byte(c.header()), message, footer, nil)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	tokenString := c.header() + base64.RawURLEncoding.EncodeToString(payload)
+	if len(footer) > 0 {
+		tokenString += "." + base64.RawURLEncoding.EncodeToString(footer)
+	}
+
+	return tokenString, nil
+}
+
+func (c *pasetoCodec) decode(tokenString string, verifyKey interface{}) (*jwtGo.Token, error) {
+	if !strings.HasPrefix(tokenString, c.header()) {
+		return nil, errors.New("token is not a " + c.purpose + " paseto token")
+	}
+
+	parts := strings.Split(tokenString[len(c.header()):], ".")
+	if len(parts) > 2 {
+		return nil, errPasetoInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errPasetoInvalid
+	}
+	var footer []byte
+	if len(parts) == 2 {
+		footer, err = base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, errPasetoInvalid
+		}
+	}
+
+	// the footer is authenticated along with the message, but only once the key it names is found
+	var kid pasetoFooter
+	if len(footer) > 0 {
+		if err := json.Unmarshal(footer, &kid); err != nil {
+			return nil, errPasetoInvalid
+		}
+	}
+
+	// key resolvers look keys up by the kid in a jwt header
+	token := &jwtGo.Token{
+		Raw:    tokenString,
+		Method: jwtGo.GetSigningMethod(c.signingMethodString()),
+		Header: map[string]interface{}{"alg": c.signingMethodString()},
+	}
+	if kid.Kid != "" {
+		token.Header["kid"] = kid.Kid
+	}
+	if resolver, ok := verifyKey.(keyResolver); ok {
+		verifyKey, err = resolver.verifyKeyForToken(token)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// a key reloaded under the same kid comes with the keys it replaced
+	verifyKeys := []interface{}{verifyKey}
+	if set, ok := verifyKey.(jwtGo.VerificationKeySet); ok {
+		verifyKeys = nil
+		for _, key := range set.Keys {
+			verifyKeys = append(verifyKeys, key)
+		}
+	}
+
+	var message []byte
+	err = errPasetoInvalid
+	for _, key := range verifyKeys {
+		message, err = c.open(payload, footer, key)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := decodePasetoClaims(message, c.flattenCustomClaims)
+	if err != nil {
+		return nil, err
+	}
+	token.Claims = claims
+
+	// paseto leaves the claims to the application, so check them the way jwts are checked
+	if err := jwtGo.NewValidator(c.parserOptions...).Validate(claims); err != nil {
+		return token, err
+	}
+	token.Valid = true
+
+	return token, nil
+}
+
+// open : the message of the payload, once it's verified (and decrypted) with verifyKey
+func (c *pasetoCodec) open(payload []byte, footer []byte, verifyKey interface{}) ([]byte, error) {
+	if c.purpose == pasetoV4Public {
+		publicKey, ok := verifyKey.(ed25519.PublicKey)
+		if !ok {
+			return nil, errors.New("v4.public tokens require an Ed25519 public key")
+		}
+		if len(payload) < ed25519.SignatureSize {
+			return nil, errPasetoInvalid
+		}
+
+		message := payload[:len(payload)-ed25519.SignatureSize]
+		signature := payload[len(payload)-ed25519.SignatureSize:]
+		if !ed25519.Verify(publicKey, pasetoPAE([]byte(c.header()), message, footer, nil), signature) {
+			return nil, errPasetoInvalid
+		}
+
+		return message, nil
+	}
+
+	key, ok := verifyKey.([]byte)
+	if !ok || len(key) != pasetoLocalKeySize {
+		return nil, errors.New("v4.local tokens require a 32 byte key")
+	}
+
+	return pasetoLocalDecrypt(key, []byte(c.header()), payload, footer, nil)
+}
+
+// pasetoLocalEncrypt : the payload of a v4.local token, the nonce followed by the ciphertext and
+// its tag, https://github.com/paseto-standard/paseto-spec/blob/master/docs/01-Protocol-Versions/Version4.md#encrypt
+func pasetoLocalEncrypt(key []byte, nonce []byte, header []byte, message []byte, footer []byte, implicit []byte) ([]byte, error) {
+	encryptionKey, counterNonce, authKey, err := pasetoLocalKeys(key, nonce)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := chacha20.NewUnauthenticatedCipher(encryptionKey, counterNonce)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := make([]byte, len(message))
+	stream.XORKeyStream(ciphertext, message)
+
+	tag, err := pasetoLocalTag(authKey, header, nonce, ciphertext, footer, implicit)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := append(append(append([]byte{}, nonce...), ciphertext...), tag...)
+	return payload, nil
+}
+
+// pasetoLocalDecrypt : the message of the payload of a v4.local token, once its tag is checked,
+// https://github.com/paseto-standard/paseto-spec/blob/master/docs/01-Protocol-Versions/Version4.md#decrypt
+func pasetoLocalDecrypt(key []byte, header []byte, payload []byte, footer []byte, implicit []byte) ([]byte, error) {
+	if len(payload) < 32+32 {
+		return nil, errPasetoInvalid
+	}
+
+	nonce, ciphertext, tag := payload[:32], payload[32:len(payload)-32], payload[len(payload)-32:]
+	encryptionKey, counterNonce, authKey, err := pasetoLocalKeys(key, nonce)
+	if err != nil {
+		return nil, err
+	}
+	expectedTag, err := pasetoLocalTag(authKey, header, nonce, ciphertext, footer, implicit)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(tag, expectedTag) {
+		return nil, errPasetoInvalid
+	}
+
+	stream, err := chacha20.NewUnauthenticatedCipher(encryptionKey, counterNonce)
+	if err != nil {
+		return nil, err
+	}
+	message := make([]byte, len(ciphertext))
+	stream.XORKeyStream(message, ciphertext)
+
+	return message, nil
+}
+
+// pasetoLocalKeys : split the key for a single message,
+// https://github.com/paseto-standard/paseto-spec/blob/master/docs/01-Protocol-Versions/Version4.md#encrypt
+func pasetoLocalKeys(key []byte, nonce []byte) (encryptionKey []byte, counterNonce []byte, authKey []byte, err error) {
+	h, err := blake2b.New(56, key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	h.Write([]byte("paseto-encryption-key"))
+	h.Write(nonce)
+	tmp := h.Sum(nil)
+
+	h, err = blake2b.New(32, key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	h.Write([]byte("paseto-auth-key-for-aead"))
+	h.Write(nonce)
+
+	return tmp[:32], tmp[32:], h.Sum(nil), nil
+}
+
+func pasetoLocalTag(authKey []byte, header []byte, nonce []byte, ciphertext []byte, footer []byte, implicit []byte) ([]byte, error) {
+	h, err := blake2b.New(32, authKey)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(pasetoPAE(header, nonce, ciphertext, footer, implicit))
+
+	return h.Sum(nil), nil
+}
+
+// pasetoPAE : pre-authentication encoding, https://github.com/paseto-standard/paseto-spec/blob/master/docs/01-Protocol-Versions/Common.md#pae-definition
+func pasetoPAE(pieces ...[]byte) []byte {
+	var le64 [8]byte
+	binary.LittleEndian.PutUint64(le64[:], uint64(len(pieces)))
+	encoded := append([]byte{}, le64[:]...)
+	for _, piece := range pieces {
+		binary.LittleEndian.PutUint64(le64[:], uint64(len(piece)))
+		encoded = append(encoded, le64[:]...)
+		encoded = append(encoded, piece...)
+	}
+
+	return encoded
+}
+
+// pasetoTimeClaims : paseto dates are RFC 3339 strings, where jwt dates are numbers
+var pasetoTimeClaims = []string{"exp", "nbf", "iat"}
+
+func encodePasetoClaims(claims *ClaimsType) ([]byte, error) {
+	encoded, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]interface{}
+	if err := unmarshalJSONNumbers(encoded, &fields); err != nil {
+		return nil, err
+	}
+	for _, name := range pasetoTimeClaims {
+		if number, ok := fields[name].(json.Number); ok {
+			seconds, err := number.Int64()
+			if err != nil {
+				return nil, errors.New("invalid " + name + " claim")
+			}
+			fields[name] = time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+		}
+	}
+
+	return json.Marshal(fields)
+}
+
+func decodePasetoClaims(message []byte, flattenCustomClaims bool) (*ClaimsType, error) {
+	var fields map[string]interface{}
+	if err := unmarshalJSONNumbers(message, &fields); err != nil {
+		return nil, err
+	}
+	for _, name := range pasetoTimeClaims {
+		if value, ok := fields[name].(string); ok {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, errors.New("invalid " + name + " claim")
+			}
+			fields[name] = t.Unix()
+		}
+	}
+
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	claims := ClaimsType{flattenCustomClaims: flattenCustomClaims}
+	if err := json.Unmarshal(encoded, &claims); err != nil {
+		return nil, err
+	}
+
+	return &claims, nil
+}
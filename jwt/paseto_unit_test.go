@@ -0,0 +1,325 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
+)
+
+func TestPasetoPAE(t *testing.T) {
+	// https://github.com/paseto-standard/paseto-spec/blob/master/docs/01-Protocol-Versions/Common.md#pae-definition
+	var paeTests = []struct {
+		pieces   [][]byte
+		expected string
+	}{
+		{nil, "0000000000000000"},
+		{[][]byte{{}}, "01000000000000000000000000000000"},
+		{[][]byte{[]byte("test")}, "0100000000000000040000000000000074657374"},
+	}
+
+	for idx, test := range paeTests {
+		if encoded := hex.EncodeToString(pasetoPAE(test.pieces...)); encoded != test.expected {
+			t.Errorf("Unexpected pre-authentication encoding; idx: %d; Expected: %s; Received: %s", idx, test.expected, encoded)
+		}
+	}
+}
+
+func TestPasetoV4PublicVector(t *testing.T) {
+	// test vector 4-S-1, https://github.com/paseto-standard/test-vectors/blob/master/v4.json
+	secretKey, _ := hex.DecodeString("b4cbfb43df4ce210727d953e4a713307fa19bb7d9f85041438d9e11b942a37741eb9dbbbbc047c03fd70604e0071f0987e16b28b757225c11f00415d0e20b1a2")
+	tokenString := "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9bg_XBBzds8lTZShVlwwKSgeKpLT3yukTw6JUz3W4h_ExsQV-P0V54zemZDcAxFaSeef1QlXEFtkqxT1ciiQEDA"
+
+	codec := &pasetoCodec{purpose: pasetoV4Public}
+	publicKey := ed25519.PrivateKey(secretKey).Public()
+
+	// the vector expired in 2022, which is reported the same way as for jwts
+	token, err := codec.decode(tokenString, publicKey)
+	if !errors.Is(err, jwtGo.ErrTokenExpired) {
+		t.Errorf("Expected the token to verify and be expired; Err: %v", err)
+	}
+	if token == nil || token.Claims.(*ClaimsType).ExpiresAt.Unix() != time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC).Unix() {
+		t.Error("Expected the exp claim to be read from the token")
+	}
+
+	// a different key must not verify it
+	otherKey, _, _ := ed25519.GenerateKey(nil)
+	if _, err := codec.decode(tokenString, otherKey); err == nil || errors.Is(err, jwtGo.ErrTokenExpired) {
+		t.Errorf("Expected the signature to not verify with another key; Err: %v", err)
+	}
+}
+
+func TestPasetoV4LocalVector(t *testing.T) {
+	// test vectors 4-E-1 and 4-E-7, https://github.com/paseto-standard/test-vectors/blob/master/v4.json
+	key, _ := hex.DecodeString("707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f")
+	message := []byte(`{"data":"this is a secret message","exp":"2022-01-01T00:00:00+00:00"}`)
+	header := []byte(pasetoV4Local + ".")
+	footer := []byte(`{"kid":"zVhMiPBP9fRf2snEcT7gFTioeA9COcNy9DfgL1W60haN"}`)
+	implicit := []byte(`{"test-vector":"4-E-7"}`)
+
+	var vectorTests = []struct {
+		name     string
+		nonce    string
+		footer   []byte
+		implicit []byte
+		token    string
+	}{
+		{
+			"4-E-1",
+			"0000000000000000000000000000000000000000000000000000000000000000",
+			nil,
+			nil,
+			"v4.local.AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAQAr68PS4AXe7If_ZgesdkUMvSwscFlAl1pk5HC0e8kApeaqMfGo_7OpBnwJOAbY9V7WU6abu74MmcUE8YWAiaArVI8XJ5hOb_4v9RmDkneN0S92dx0OW4pgy7omxgf3S8c3LlQg",
+		},
+		{
+			"4-E-7",
+			"df654812bac492663825520ba2f6e67cf5ca5bdc13d4e7507a98cc4c2fcc3ad8",
+			footer,
+			implicit,
+			"v4.local.32VIErrEkmY4JVILovbmfPXKW9wT1OdQepjMTC_MOtjA4kiqw7_tcaOM5GNEcnTxl60WkwMsYXw6FSNb_UdJPXjpzm0KW9ojM5f4O2mRvE2IcweP-PRdoHjd5-RHCiExR1IK6t40KCCWLA7GYL9KFHzKlwY9_RnIfRrMQpueydLEAZGGcA.eyJraWQiOiJ6VmhNaVBCUDlmUmYyc25FY1Q3Z0ZUaW9lQTlDT2NOeTlEZmdMMVc2MGhhTiJ9",
+		},
+	}
+
+	var payload []byte
+	for _, test := range vectorTests {
+		nonce, _ := hex.DecodeString(test.nonce)
+		encrypted, err := pasetoLocalEncrypt(key, nonce, header, message, test.footer, test.implicit)
+		if err != nil {
+			t.Fatalf("[%s] Unable to encrypt message; Err: %v", test.name, err)
+		}
+		token := string(header) + base64.RawURLEncoding.EncodeToString(encrypted)
+		if len(test.footer) > 0 {
+			token += "." + base64.RawURLEncoding.EncodeToString(test.footer)
+		}
+		if token != test.token {
+			t.Errorf("[%s] Unexpected token; Expected: %s; Received: %s", test.name, test.token, token)
+		}
+
+		// and the token of the vector is decrypted
+		parts := strings.Split(strings.TrimPrefix(test.token, string(header)), ".")
+		payload, err = base64.RawURLEncoding.DecodeString(parts[0])
+		if err != nil {
+			t.Fatalf("[%s] Unable to decode payload; Err: %v", test.name, err)
+		}
+		var vectorFooter []byte
+		if len(parts) > 1 {
+			if vectorFooter, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+				t.Fatalf("[%s] Unable to decode footer; Err: %v", test.name, err)
+			}
+		}
+		decrypted, err := pasetoLocalDecrypt(key, header, payload, vectorFooter, test.implicit)
+		if err != nil || !bytes.Equal(decrypted, message) {
+			t.Errorf("[%s] Expected the message to be decrypted; Received: %s; Err: %v", test.name, decrypted, err)
+		}
+	}
+
+	// the tag of 4-E-7 covers the header, the footer and the implicit assertion
+	otherKey := bytes.Repeat([]byte("k"), 32)
+	var tagTests = []struct {
+		name     string
+		key      []byte
+		header   []byte
+		footer   []byte
+		implicit []byte
+	}{
+		{"other key", otherKey, header, footer, implicit},
+		{"other header", key, []byte("v3.local."), footer, implicit},
+		{"other footer", key, header, []byte(`{"kid":"other"}`), implicit},
+		{"no footer", key, header, nil, implicit},
+		{"other implicit assertion", key, header, footer, []byte(`{"test-vector":"4-E-8"}`)},
+		{"no implicit assertion", key, header, footer, nil},
+	}
+	for _, test := range tagTests {
+		if _, err := pasetoLocalDecrypt(test.key, test.header, payload, test.footer, test.implicit); err != errPasetoInvalid {
+			t.Errorf("[%s] Expected the payload to be refused; Err: %v", test.name, err)
+		}
+	}
+}
+
+func TestPasetoV4FailureVectors(t *testing.T) {
+	// the failures of test vectors 4-F-*, https://github.com/paseto-standard/test-vectors/blob/master/v4.json
+	localKey := bytes.Repeat([]byte("k"), 32)
+	publicKey, privateKey, _ := ed25519.GenerateKey(nil)
+	claims := &ClaimsType{RegisteredClaims: jwtGo.RegisteredClaims{ExpiresAt: jwtGo.NewNumericDate(time.Now().Add(time.Hour))}}
+
+	local := &pasetoCodec{purpose: pasetoV4Local}
+	localToken, err := local.encode(jwtGo.NewWithClaims(jwtGo.SigningMethodHS256, claims), keyringEntry{kid: "kid", signKey: localKey})
+	if err != nil {
+		t.Fatalf("Unable to encode token; Err: %v", err)
+	}
+	public := &pasetoCodec{purpose: pasetoV4Public}
+	publicToken, err := public.encode(jwtGo.NewWithClaims(jwtGo.SigningMethodEdDSA, claims), keyringEntry{kid: "kid", signKey: privateKey})
+	if err != nil {
+		t.Fatalf("Unable to encode token; Err: %v", err)
+	}
+
+	// the tokens are valid as they are
+	if _, err := local.decode(localToken, localKey); err != nil {
+		t.Fatalf("Expected the v4.local token to be valid; Err: %v", err)
+	}
+	if _, err := public.decode(publicToken, publicKey); err != nil {
+		t.Fatalf("Expected the v4.public token to be valid; Err: %v", err)
+	}
+
+	modify := func(tokenString string, part int, modifier func(string) string) string {
+		parts := strings.Split(tokenString, ".")
+		parts[part] = modifier(parts[part])
+		return strings.Join(parts, ".")
+	}
+	flipLast := func(s string) string {
+		if s[len(s)-2] == 'A' {
+			return s[:len(s)-2] + "B" + s[len(s)-1:]
+		}
+		return s[:len(s)-2] + "A" + s[len(s)-1:]
+	}
+	otherFooter := func(string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(`{"kid":"other"}`))
+	}
+
+	var failureTests = []struct {
+		name        string
+		codec       *pasetoCodec
+		tokenString string
+		key         interface{}
+	}{
+		{"v4.local token as v4.public", public, localToken, publicKey},
+		{"v4.public token as v4.local", local, publicToken, localKey},
+		{"v4.public token with the local key", public, strings.Replace(publicToken, pasetoV4Public, pasetoV4Local, 1), publicKey},
+		{"v3.local token", local, strings.Replace(localToken, "v4.", "v3.", 1), localKey},
+		{"v3.public token", public, strings.Replace(publicToken, "v4.", "v3.", 1), publicKey},
+		{"modified v4.local tag", local, modify(localToken, 2, flipLast), localKey},
+		{"modified v4.public signature", public, modify(publicToken, 2, flipLast), publicKey},
+		{"modified v4.local footer", local, modify(localToken, 3, otherFooter), localKey},
+		{"modified v4.public footer", public, modify(publicToken, 3, otherFooter), publicKey},
+		{"removed v4.local footer", local, strings.Join(strings.Split(localToken, ".")[:3], "."), localKey},
+		{"padded v4.local payload", local, modify(localToken, 2, func(s string) string { return s + "==" }), localKey},
+		{"v4.local token with the wrong key", local, localToken, bytes.Repeat([]byte("o"), 32)},
+		{"short v4.local payload", local, pasetoV4Local + "." + base64.RawURLEncoding.EncodeToString(make([]byte, 63)), localKey},
+	}
+
+	for _, test := range failureTests {
+		token, err := test.codec.decode(test.tokenString, test.key)
+		if err == nil || (token != nil && token.Valid) {
+			t.Errorf("[%s] Expected the token to be refused", test.name)
+		}
+	}
+}
+
+func TestPasetoTokens(t *testing.T) {
+	var formatTests = []struct {
+		format  string
+		options Options
+	}{
+		{pasetoV4Public, Options{PrivateKeyLocation: "test/ed25519_priv.pem", PublicKeyLocation: "test/ed25519_pub.pem"}},
+		{pasetoV4Local, Options{HMACKey: bytes.Repeat([]byte("k"), 32)}},
+		{pasetoV4Local, Options{KeyRotationInterval: 30 * 24 * time.Hour}},
+	}
+
+	for idx, test := range formatTests {
+		options := test.options
+		options.TokenFormat = test.format
+		options.IsDevEnv = true
+
+		var a Auth
+		if err := New(&a, options); err != nil {
+			t.Fatalf("Unable to build jwt auth for testing; idx: %d; Err: %v", idx, err)
+		}
+
+		claims := ClaimsType{CustomClaims: map[string]interface{}{"role": "admin"}}
+		w := httptest.NewRecorder()
+		if err := a.IssueNewTokens(w, &claims); err != nil {
+			t.Fatalf("Unable to issue tokens; idx: %d; Err: %v", idx, err)
+		}
+
+		req, reqErr := http.NewRequest("GET", "http://localhost:8080/", nil)
+		if reqErr != nil {
+			t.Fatalf("Error building request for testing; err: %v", reqErr)
+		}
+		var authTokenString string
+		for _, cookie := range w.Result().Cookies() {
+			req.AddCookie(cookie)
+			if cookie.Name == a.options.AuthTokenName {
+				authTokenString = cookie.Value
+			}
+		}
+		req.Header.Add(a.options.CSRFTokenName, w.Header().Get(a.options.CSRFTokenName))
+
+		if !strings.HasPrefix(authTokenString, test.format+".") {
+			t.Errorf("Expected a %s token; idx: %d; Received: %s", test.format, idx, authTokenString)
+		}
+		if test.format == pasetoV4Local && strings.Contains(authTokenString, "admin") {
+			t.Errorf("Expected the claims of a v4.local token to be encrypted; idx: %d", idx)
+		}
+
+		rec := httptest.NewRecorder()
+		a.Handler(myHandlerFunc).ServeHTTP(rec, req)
+		if rec.Code != 200 || rec.Body.String() != "In Handler Func" {
+			t.Errorf("Expected paseto tokens to be accepted; idx: %d; Received: %d %s", idx, rec.Code, rec.Body.String())
+		}
+
+		var c credentials
+		if err := a.buildCredentialsFromStrings("", authTokenString, "", &c); err != nil {
+			t.Errorf("Unable to build credentials; idx: %d; Err: %v", idx, err)
+		}
+		if c.AuthToken.ParseErr != nil || c.AuthToken.Token.Claims.(*ClaimsType).CustomClaims["role"] != "admin" {
+			t.Errorf("Expected the claims to be read from the token; idx: %d; Err: %v", idx, c.AuthToken.ParseErr)
+		}
+
+		// a modified payload is refused
+		parts := strings.SplitN(authTokenString, ".", 3)
+		payload := []byte(parts[2])
+		if payload[10] == 'A' {
+			payload[10] = 'B'
+		} else {
+			payload[10] = 'A'
+		}
+		if err := a.buildCredentialsFromStrings("", parts[0]+"."+parts[1]+"."+string(payload), "", &c); err != nil {
+			t.Errorf("Unable to build credentials; idx: %d; Err: %v", idx, err)
+		}
+		if c.AuthToken.ParseErr == nil {
+			t.Errorf("Expected a modified token to be refused; idx: %d", idx)
+		}
+
+		// and so are jwts, whatever their signature
+		var jwt credentials
+		if err := a.buildCredentialsFromClaims(&jwt, &claims); err != nil {
+			t.Errorf("Unable to build credentials; idx: %d; Err: %v", idx, err)
+		}
+		jwtString, signErr := a.signToken(jwt.AuthToken.Token)
+		if signErr != nil {
+			t.Fatalf("Unable to sign auth token; Err: %v", signErr)
+		}
+		if err := a.buildCredentialsFromStrings(jwt.CsrfString, jwtString, "", &c); err != nil {
+			t.Errorf("Unable to build credentials; idx: %d; Err: %v", idx, err)
+		}
+		if c.AuthToken.ParseErr == nil {
+			t.Errorf("Expected a jwt to be refused; idx: %d", idx)
+		}
+
+		a.Close()
+	}
+
+	var optionTests = []struct {
+		name    string
+		options Options
+	}{
+		{"unknown format", Options{TokenFormat: "v3.public", SigningMethodString: "HS256", HMACKey: []byte("test key")}},
+		{"wrong signing method", Options{TokenFormat: pasetoV4Public, SigningMethodString: "RS256", PrivateKeyLocation: "test/priv.rsa", PublicKeyLocation: "test/priv.rsa.pub"}},
+		{"short key", Options{TokenFormat: pasetoV4Local, HMACKey: []byte("test key")}},
+		{"token encryption", Options{TokenFormat: pasetoV4Local, HMACKey: bytes.Repeat([]byte("k"), 32), TokenEncryption: "dir", TokenEncryptionKey: bytes.Repeat([]byte("k"), 32)}},
+	}
+	for _, test := range optionTests {
+		var a Auth
+		if err := New(&a, test.options); err == nil {
+			t.Errorf("Expected an error building jwt auth; test: %s", test.name)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package jwt
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	refreshTokenReferenceSize = 32
+
+	// how often the memory store drops expired refresh tokens, at most
+	memoryRefreshTokenStoreSweepInterval = 1 * time.Minute
+)
+
+// ErrRefreshTokenNotFound : returned by a RefreshTokenStore for a refresh token it doesn't hold,
+// e.g. because it has expired. Revoked refresh tokens are reported with ErrRefreshRevoked.
+var ErrRefreshTokenNotFound = errors.New("refresh token not found")
+
+// RefreshTokenStore : holds the claims of opaque refresh tokens. Tokens are keyed by their hash,
+// so the store can't be used to forge requests. The claims can be dropped once they expire
+// (claims.ExpiresAt). A revoked token should be remembered until then, so that its use is
+// reported with ErrRefreshRevoked.
+type RefreshTokenStore interface {
+	SaveRefreshToken(key string, claims ClaimsType) error
+	// LoadRefreshToken : the claims of a refresh token, or ErrRefreshTokenNotFound, or
+	// ErrRefreshRevoked, along with the claims when they're still known
+	LoadRefreshToken(key string) (ClaimsType, error)
+	// TakeRefreshToken : LoadRefreshToken, and revoke the token in the same step, so that
+	// only one of concurrent refreshes with the token can succeed
+	TakeRefreshToken(key string) (ClaimsType, error)
+	DeleteRefreshToken(key string) error
+}
+
+// MemoryRefreshTokenStore : a RefreshTokenStore for a single server. The tokens are lost on
+// a restart, which logs every user out.
+type MemoryRefreshTokenStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryRefreshTokenEntry
+	lastSweep time.Time
+}
+
+type memoryRefreshTokenEntry struct {
+	claims  ClaimsType
+	revoked bool
+}
+
+// NewMemoryRefreshTokenStore : an empty in-memory RefreshTokenStore
+func NewMemoryRefreshTokenStore() *MemoryRefreshTokenStore {
+	return &MemoryRefreshTokenStore{
+		entries:   make(map[string]memoryRefreshTokenEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// SaveRefreshToken : store the claims of a refresh token
+func (s *MemoryRefreshTokenStore) SaveRefreshToken(key string, claims ClaimsType) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > memoryRefreshTokenStoreSweepInterval {
+		for k, entry := range s.entries {
+			if entry.claims.ExpiresAt != nil && now.After(entry.claims.ExpiresAt.Time) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	s.entries[key] = memoryRefreshTokenEntry{claims: claims}
+	return nil
+}
+
+// LoadRefreshToken : the claims of a refresh token, or ErrRefreshTokenNotFound, or ErrRefreshRevoked
+func (s *MemoryRefreshTokenStore) LoadRefreshToken(key string) (ClaimsType, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.load(key)
+}
+
+// TakeRefreshToken : the claims of a refresh token, which is revoked
+func (s *MemoryRefreshTokenStore) TakeRefreshToken(key string) (ClaimsType, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	claims, err := s.load(key)
+	if err != nil {
+		return claims, err
+	}
+	s.entries[key] = memoryRefreshTokenEntry{claims: claims, revoked: true}
+
+	return claims, nil
+}
+
+// DeleteRefreshToken : revoke a refresh token
+func (s *MemoryRefreshTokenStore) DeleteRefreshToken(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[key]; ok {
+		entry.revoked = true
+		s.entries[key] = entry
+	}
+	return nil
+}
+
+func (s *MemoryRefreshTokenStore) load(key string) (ClaimsType, error) {
+	entry, ok := s.entries[key]
+	if !ok {
+		return ClaimsType{}, ErrRefreshTokenNotFound
+	}
+	if entry.revoked {
+		return entry.claims, ErrRefreshRevoked
+	}
+
+	return entry.claims, nil
+}
+
+// refreshTokenKey : the key a refresh token is stored under
+func refreshTokenKey(reference string) string {
+	sum := sha256.Sum256([]byte(reference))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// encodeRefreshToken : the refresh token as it's handed to the client. With a
+// RefreshTokenStore it's a random reference to the claims, which are kept by the store.
+func (a *Auth) encodeRefreshToken(token *jwtGo.Token) (string, error) {
+	if a.options.RefreshTokenStore == nil {
+		return a.encodeToken(token)
+	}
+
+	claims, ok := token.Claims.(*ClaimsType)
+	if !ok {
+		return "", errors.New("cannot read token claims")
+	}
+
+	reference, err := randomBytes(refreshTokenReferenceSize)
+	if err != nil {
+		return "", err
+	}
+	referenceString := base64.RawURLEncoding.EncodeToString(reference)
+	if err := a.options.RefreshTokenStore.SaveRefreshToken(refreshTokenKey(referenceString), *claims); err != nil {
+		return "", err
+	}
+
+	return referenceString, nil
+}
+
+// loadRefreshToken : look up the claims of an opaque refresh token
+func (c *credentials) loadRefreshToken() *Error {
+	if c.RefreshTokenReference == "" {
+		return newReasonError(ErrRefreshTokenInvalid, nil, 401)
+	}
+
+	// opaque refresh tokens are revoked in the store, so looking one up is the revocation check
+	_, span := c.tracer().Start(c.context(), "jwt.revocation_check")
+	start := time.Now()
+	claims, err := c.options.RefreshTokenStore.LoadRefreshToken(refreshTokenKey(c.RefreshTokenReference))
+	c.metrics().RevocationChecked(time.Since(start))
+	span.SetAttributes(attribute.Bool(attributeValid, err == nil))
+	span.End()
+	if errors.Is(err, ErrRefreshRevoked) {
+		// a revoked token that's still used may have been stolen. The claims it was stored with,
+		// when the store still has them, go with the RefreshRevokedDetected event.
+		c.RefreshToken = c.storedRefreshToken(claims, ErrRefreshRevoked)
+		c.log().Warn("refresh token has been revoked", append(tokenLogAttrs(c.RefreshToken), "reason", reasonOf(ErrRefreshRevoked))...)
+		return newReasonError(ErrRefreshRevoked, nil, 401)
+	}
+	if errors.Is(err, ErrRefreshTokenNotFound) {
+		c.log().Debug("refresh token is unknown or has expired", "reason", reasonOf(ErrRefreshTokenInvalid))
+		return newReasonError(ErrRefreshTokenInvalid, err, 401)
+	}
+	if err != nil {
+		return newJwtError(err, 500)
+	}
+
+	// the stored claims are checked the way the claims of a signed refresh token are
+	c.RefreshToken = c.storedRefreshToken(claims, jwtGo.NewValidator(c.options.ParserOptions...).Validate(&claims))
+
+	return nil
+}
+
+// storedRefreshToken : the refresh token of claims kept by the store, valid without a validationErr
+func (c *credentials) storedRefreshToken(claims ClaimsType, validationErr error) *jwtToken {
+	return &jwtToken{
+		Token: &jwtGo.Token{
+			Raw:    c.RefreshTokenReference,
+			Header: map[string]interface{}{},
+			Claims: &claims,
+			Valid:  validationErr == nil,
+		},
+		ParseErr: validationErr,
+		options: tokenOptions{
+			ValidTime:           c.options.RefreshTokenValidTime,
+			SigningMethodString: c.options.SigningMethodString,
+			Logger:              c.options.Logger,
+		},
+	}
+}
+
+// takeRefreshToken : revoke the opaque refresh token the credentials were built from, as it's
+// used. It fails with ErrRefreshRevoked when another request has used it first.
+func (c *credentials) takeRefreshToken() *Error {
+	_, err := c.options.RefreshTokenStore.TakeRefreshToken(refreshTokenKey(c.RefreshTokenReference))
+	if errors.Is(err, ErrRefreshRevoked) || errors.Is(err, ErrRefreshTokenNotFound) {
+		c.log().Warn("refresh token has been used concurrently", append(tokenLogAttrs(c.RefreshToken), "reason", reasonOf(ErrRefreshRevoked))...)
+		return newReasonError(ErrRefreshRevoked, nil, 401)
+	}
+	if err != nil {
+		return newJwtError(err, 500)
+	}
+
+	return nil
+}
+
+// deleteRefreshToken : revoke the opaque refresh token the credentials were built from
+func (c *credentials) deleteRefreshToken() error {
+	if c.RefreshTokenReference == "" {
+		return nil
+	}
+
+	return c.options.RefreshTokenStore.DeleteRefreshToken(refreshTokenKey(c.RefreshTokenReference))
+}
@@ -0,0 +1,227 @@
+package jwt
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
+)
+
+func TestOpaqueRefreshTokens(t *testing.T) {
+	store := NewMemoryRefreshTokenStore()
+
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString: "HS256",
+		HMACKey:             []byte("test key"),
+		RefreshTokenStore:   store,
+		BearerTokens:        true,
+		UpdateTokenClaims:   func(claims *ClaimsType) ClaimsType { return *claims },
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+
+	claims := ClaimsType{CustomClaims: map[string]interface{}{"role": "admin"}}
+	w := httptest.NewRecorder()
+	if err := a.IssueNewTokens(w, &claims); err != nil {
+		t.Fatalf("Unable to issue tokens; Err: %v", err)
+	}
+	csrf := w.Header().Get(a.options.CSRFTokenName)
+	refreshTokenString := w.Header().Get(a.options.RefreshTokenName)
+	if refreshTokenString == "" || strings.Contains(refreshTokenString, ".") {
+		t.Fatalf("Expected an opaque refresh token; Received: %s", refreshTokenString)
+	}
+	stored, err := store.LoadRefreshToken(refreshTokenKey(refreshTokenString))
+	if err != nil || stored.Csrf != csrf || stored.CustomClaims["role"] != "admin" {
+		t.Errorf("Expected the refresh token claims to be stored; Err: %v", err)
+	}
+
+	newRequest := func(authTokenString string, refreshTokenString string) *http.Request {
+		req, reqErr := http.NewRequest("GET", "http://localhost:8080/", nil)
+		if reqErr != nil {
+			t.Fatalf("Error building request for testing; err: %v", reqErr)
+		}
+		req.Header.Set(a.options.AuthTokenName, authTokenString)
+		req.Header.Set(a.options.RefreshTokenName, refreshTokenString)
+		req.Header.Set(a.options.CSRFTokenName, csrf)
+		return req
+	}
+
+	// a valid auth token doesn't touch the store, and the refresh token is left as it is
+	rec := httptest.NewRecorder()
+	a.Handler(myHandlerFunc).ServeHTTP(rec, newRequest(w.Header().Get(a.options.AuthTokenName), refreshTokenString))
+	if rec.Code != 200 {
+		t.Errorf("Expected the request to succeed; Received: %d", rec.Code)
+	}
+	if rec.Header().Get(a.options.RefreshTokenName) != "" {
+		t.Errorf("Expected the refresh token to not be reissued; Received: %s", rec.Header().Get(a.options.RefreshTokenName))
+	}
+
+	refreshClaims, err := a.GrabRefreshTokenClaims(newRequest(w.Header().Get(a.options.AuthTokenName), refreshTokenString))
+	if err != nil || refreshClaims.CustomClaims["role"] != "admin" {
+		t.Errorf("Expected the refresh token claims to be looked up; Err: %v", err)
+	}
+
+	// an expired auth token is refreshed with the stored claims, and the refresh token is replaced
+	expiredClaims := ClaimsType{Csrf: csrf, TokenUse: tokenUseAccess}
+	expiredClaims.ExpiresAt = jwtGo.NewNumericDate(time.Now().Add(-time.Minute))
+	expiredAuthTokenString, err := a.encodeToken(newAuthTokenWithClaims(jwtGo.SigningMethodHS256, &expiredClaims))
+	if err != nil {
+		t.Fatalf("Unable to sign auth token; Err: %v", err)
+	}
+
+	rec = httptest.NewRecorder()
+	a.Handler(myHandlerFunc).ServeHTTP(rec, newRequest(expiredAuthTokenString, refreshTokenString))
+	if rec.Code != 200 {
+		t.Fatalf("Expected the tokens to be refreshed; Received: %d", rec.Code)
+	}
+	newRefreshTokenString := rec.Header().Get(a.options.RefreshTokenName)
+	newCsrf := rec.Header().Get(a.options.CSRFTokenName)
+	if newRefreshTokenString == "" || newRefreshTokenString == refreshTokenString {
+		t.Errorf("Expected a new refresh token; Received: %s", newRefreshTokenString)
+	}
+	if _, err := store.LoadRefreshToken(refreshTokenKey(refreshTokenString)); !errors.Is(err, ErrRefreshRevoked) {
+		t.Errorf("Expected the used refresh token to be revoked; Err: %v", err)
+	}
+
+	// so it can't be used again
+	if _, jwtErr := a.Process(httptest.NewRecorder(), newRequest(expiredAuthTokenString, refreshTokenString)); !errors.Is(jwtErr, ErrRefreshRevoked) || jwtErr.Type != 401 {
+		t.Errorf("Expected a used refresh token to be refused as revoked; Err: %v", jwtErr)
+	}
+
+	// an unknown one is only invalid
+	if _, jwtErr := a.Process(httptest.NewRecorder(), newRequest(expiredAuthTokenString, "unknown")); !errors.Is(jwtErr, ErrRefreshTokenInvalid) {
+		t.Errorf("Expected an unknown refresh token to be refused as invalid; Err: %v", jwtErr)
+	}
+
+	// logging out revokes the refresh token
+	csrf = newCsrf
+	if err := a.NullifyTokens(httptest.NewRecorder(), newRequest("", newRefreshTokenString)); err != nil {
+		t.Errorf("Unable to nullify tokens; Err: %v", err)
+	}
+	if _, err := store.LoadRefreshToken(refreshTokenKey(newRefreshTokenString)); !errors.Is(err, ErrRefreshRevoked) {
+		t.Errorf("Expected the refresh token to be revoked; Err: %v", err)
+	}
+}
+
+func TestOpaqueRefreshTokenConcurrentUse(t *testing.T) {
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString: "HS256",
+		HMACKey:             []byte("test key"),
+		RefreshTokenStore:   NewMemoryRefreshTokenStore(),
+		BearerTokens:        true,
+		UpdateTokenClaims:   func(claims *ClaimsType) ClaimsType { return *claims },
+		Logger:              slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+
+	w := httptest.NewRecorder()
+	if err := a.IssueNewTokens(w, &ClaimsType{UID: "user id"}); err != nil {
+		t.Fatalf("Unable to issue tokens; Err: %v", err)
+	}
+	csrf := w.Header().Get(a.options.CSRFTokenName)
+
+	expiredClaims := ClaimsType{Csrf: csrf, TokenUse: tokenUseAccess}
+	expiredClaims.ExpiresAt = jwtGo.NewNumericDate(time.Now().Add(-time.Minute))
+	expiredAuthTokenString, err := a.encodeToken(newAuthTokenWithClaims(jwtGo.SigningMethodHS256, &expiredClaims))
+	if err != nil {
+		t.Fatalf("Unable to sign auth token; Err: %v", err)
+	}
+
+	// every request refreshes with the same refresh token, at the same time
+	const requests = 16
+	var wg sync.WaitGroup
+	var refreshed, revoked int32
+	for i := 0; i < requests; i++ {
+		req, reqErr := http.NewRequest("GET", "http://localhost:8080/", nil)
+		if reqErr != nil {
+			t.Fatalf("Error building request for testing; err: %v", reqErr)
+		}
+		req.Header.Set(a.options.AuthTokenName, expiredAuthTokenString)
+		req.Header.Set(a.options.RefreshTokenName, w.Header().Get(a.options.RefreshTokenName))
+		req.Header.Set(a.options.CSRFTokenName, csrf)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, jwtErr := a.Process(httptest.NewRecorder(), req)
+			if jwtErr == nil {
+				atomic.AddInt32(&refreshed, 1)
+			} else if errors.Is(jwtErr, ErrRefreshRevoked) {
+				atomic.AddInt32(&revoked, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if refreshed != 1 || revoked != requests-1 {
+		t.Errorf("Expected a single refresh; Received: %d refreshed, %d revoked", refreshed, revoked)
+	}
+}
+
+func TestOpaqueRefreshTokenClaimsValidation(t *testing.T) {
+	store := NewMemoryRefreshTokenStore()
+
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString: "HS256",
+		HMACKey:             []byte("test key"),
+		RefreshTokenStore:   store,
+		BearerTokens:        true,
+		Issuer:              "issuer",
+		Audience:            "audience",
+		Leeway:              time.Minute,
+		UpdateTokenClaims:   func(claims *ClaimsType) ClaimsType { return *claims },
+		Logger:              slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+
+	// the stored claims are checked with the options of the parser
+	var validationTests = []struct {
+		name          string
+		issuer        string
+		audience      string
+		expiresAt     time.Time
+		expectedValid bool
+	}{
+		{"valid", "issuer", "audience", time.Now().Add(time.Hour), true},
+		{"expired within the leeway", "issuer", "audience", time.Now().Add(-30 * time.Second), true},
+		{"expired", "issuer", "audience", time.Now().Add(-2 * time.Minute), false},
+		{"other issuer", "other", "audience", time.Now().Add(time.Hour), false},
+		{"other audience", "issuer", "other", time.Now().Add(time.Hour), false},
+	}
+
+	for _, test := range validationTests {
+		claims := ClaimsType{UID: "user id", TokenUse: tokenUseRefresh}
+		claims.Issuer = test.issuer
+		claims.Audience = jwtGo.ClaimStrings{test.audience}
+		claims.ExpiresAt = jwtGo.NewNumericDate(test.expiresAt)
+		if err := store.SaveRefreshToken(refreshTokenKey(test.name), claims); err != nil {
+			t.Fatalf("Unable to store refresh token; Err: %v", err)
+		}
+
+		c := credentials{RefreshTokenReference: test.name}
+		c.options.RefreshTokenStore = store
+		c.options.ParserOptions = a.options.parserOptions()
+		if err := c.loadRefreshToken(); err != nil {
+			t.Fatalf("[%s] Unable to load refresh token; Err: %v", test.name, err)
+		}
+		if c.RefreshToken.Token.Valid != test.expectedValid {
+			t.Errorf("[%s] Expected valid to be %v; Err: %v", test.name, test.expectedValid, c.RefreshToken.ParseErr)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package jwt
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const problemDetailsContentType = "application/problem+json"
+
+// problemDetails : an RFC 7807 error body, https://www.rfc-editor.org/rfc/rfc7807
+type problemDetails struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// WWWAuthenticateHandler : a 401 handler with an RFC 6750 challenge. The error code and
+// description tell clients why their token was refused, e.g.
+// WWW-Authenticate: Bearer error="invalid_token", error_description="token is expired"
+func WWWAuthenticateHandler(w http.ResponseWriter, r *http.Request) {
+	setWWWAuthenticate(w, r)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// ProblemDetailsHandler : answers with an RFC 7807 application/problem+json body, carrying
+// the reason code of the error. It can be used as both the unauthorized and the error handler,
+// and sets the WWW-Authenticate challenge of 401s.
+func ProblemDetailsHandler(w http.ResponseWriter, r *http.Request) {
+	problem := problemDetails{
+		Type:   "about:blank",
+		Status: http.StatusInternalServerError,
+		Reason: reasonInternalError,
+	}
+	if err, ok := ErrorFromContext(r.Context()); ok {
+		problem.Status = err.Type
+		problem.Reason = err.Reason
+		// the causes of internal errors aren't the client's business
+		if err.Type/100 == 4 {
+			problem.Detail = err.Error()
+		}
+	}
+	problem.Title = http.StatusText(problem.Status)
+
+	if problem.Status == http.StatusUnauthorized {
+		setWWWAuthenticate(w, r)
+	}
+	w.Header().Set("Content-Type", problemDetailsContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	_ = json.NewEncoder(w).Encode(problem)
+}
+
+// setWWWAuthenticate : the bearer challenge of a refused request,
+// https://www.rfc-editor.org/rfc/rfc6750#section-3
+func setWWWAuthenticate(w http.ResponseWriter, r *http.Request) {
+	err, ok := ErrorFromContext(r.Context())
+	// requests without credentials get no error code
+	if !ok || err.Reason == reasonOf(ErrNoAuthToken) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		return
+	}
+
+	code := "invalid_token"
+	if err.Reason == reasonOf(ErrNoCSRFToken) || err.Reason == reasonOf(ErrCSRFMismatch) {
+		code = "invalid_request"
+	}
+	w.Header().Set("WWW-Authenticate", `Bearer error="`+code+`", error_description="`+challengeDescription(err.Error())+`"`)
+}
+
+// challengeDescription : the description, with only the characters RFC 6750 allows
+func challengeDescription(description string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return -1
+		}
+		return r
+	}, description)
+}
@@ -0,0 +1,139 @@
+package jwt
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
+)
+
+func TestErrorResponses(t *testing.T) {
+	options := Options{
+		SigningMethodString: "HS256",
+		HMACKey:             []byte("test key"),
+		BearerTokens:        true,
+	}
+	var issuer Auth
+	if authErr := New(&issuer, options); authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+
+	// a verify only server can't refresh expired tokens
+	var a Auth
+	options.VerifyOnlyServer = true
+	if authErr := New(&a, options); authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+
+	csrf := "csrf string"
+	signClaims := func(expiresAt time.Time) string {
+		claims := ClaimsType{Csrf: csrf, TokenUse: tokenUseAccess}
+		claims.ExpiresAt = jwtGo.NewNumericDate(expiresAt)
+		tokenString, err := issuer.encodeToken(newAuthTokenWithClaims(jwtGo.SigningMethodHS256, &claims))
+		if err != nil {
+			t.Fatalf("Unable to sign auth token; Err: %v", err)
+		}
+		return tokenString
+	}
+	validToken := signClaims(time.Now().Add(time.Minute))
+	expiredToken := signClaims(time.Now().Add(-time.Minute))
+
+	var tests = []struct {
+		name            string
+		authToken       string
+		csrf            string
+		expectedReason  string
+		expectedWWWAuth string
+	}{
+		{"no token", "", csrf, "no_auth_token", "Bearer"},
+		{"expired token", expiredToken, csrf, "token_expired", `Bearer error="invalid_token", error_description="token is expired: server is not authorized to issue new tokens"`},
+		{"invalid token", "not a token", csrf, "token_invalid", `Bearer error="invalid_token"`},
+		{"csrf mismatch", validToken, "other csrf string", "csrf_mismatch", `Bearer error="invalid_request", error_description="CSRF token doesn't match value in token"`},
+	}
+
+	newRequest := func(authToken string, csrf string) *http.Request {
+		req, reqErr := http.NewRequest("GET", "http://localhost:8080/", nil)
+		if reqErr != nil {
+			t.Fatalf("Error building request for testing; err: %v", reqErr)
+		}
+		req.Header.Set(a.options.AuthTokenName, authToken)
+		req.Header.Set(a.options.CSRFTokenName, csrf)
+		return req
+	}
+
+	handler := a.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newRequest(test.authToken, test.csrf))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("[%s] Expected a 401; Received: %d", test.name, rec.Code)
+		}
+		if !strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), test.expectedWWWAuth) {
+			t.Errorf("[%s] Expected WWW-Authenticate %q; Received: %q", test.name, test.expectedWWWAuth, rec.Header().Get("WWW-Authenticate"))
+		}
+	}
+
+	// the problem details carry the reason code
+	a.SetUnauthorizedHandler(http.HandlerFunc(ProblemDetailsHandler))
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newRequest(test.authToken, test.csrf))
+		if rec.Header().Get("Content-Type") != problemDetailsContentType {
+			t.Errorf("[%s] Expected a problem details body; Received: %q", test.name, rec.Header().Get("Content-Type"))
+		}
+
+		var problem problemDetails
+		if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+			t.Fatalf("[%s] Unable to decode problem details; Err: %v", test.name, err)
+		}
+		if problem.Status != http.StatusUnauthorized || problem.Reason != test.expectedReason || problem.Title != "Unauthorized" {
+			t.Errorf("[%s] Expected reason %s; Received: %+v", test.name, test.expectedReason, problem)
+		}
+	}
+
+	// custom handlers get the error from the request context
+	var received *Error
+	a.SetUnauthorizedHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = ErrorFromContext(r.Context())
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest(expiredToken, csrf))
+	if !errors.Is(received, ErrTokenExpired) {
+		t.Errorf("Expected the expired token error in the request context; Received: %v", received)
+	}
+
+	// internal errors don't disclose their cause
+	rec := httptest.NewRecorder()
+	req := requestWithError(newRequest("", ""), newJwtError(errors.New("secret cause"), 500))
+	ProblemDetailsHandler(rec, req)
+	var problem problemDetails
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("Unable to decode problem details; Err: %v", err)
+	}
+	if rec.Code != 500 || problem.Reason != reasonInternalError || problem.Detail != "" {
+		t.Errorf("Expected an internal error without details; Received: %+v", problem)
+	}
+}
+
+func TestChallengeDescription(t *testing.T) {
+	var tests = []struct {
+		description string
+		expected    string
+	}{
+		{"token is expired", "token is expired"},
+		{`bad "quoted" token`, "bad quoted token"},
+		{"line\nbreak\\", "linebreak"},
+		{"café", "caf"},
+	}
+
+	for _, test := range tests {
+		if received := challengeDescription(test.description); received != test.expected {
+			t.Errorf("Expected %q; Received: %q", test.expected, received)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/big"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
+)
+
+// LocalSigner : an in-process crypto.Signer that stands in for a KMS, an HSM or a signing
+// daemon in tests and development. Auth only sees the crypto.Signer interface, so tokens are
+// signed exactly as they would be with an external signer.
+type LocalSigner struct {
+	key crypto.Signer
+}
+
+// NewLocalSigner : wrap an RSA, ECDSA or Ed25519 private key
+func NewLocalSigner(key crypto.Signer) *LocalSigner {
+	return &LocalSigner{key: key}
+}
+
+// Public : the public half of the wrapped key
+func (s *LocalSigner) Public() crypto.PublicKey {
+	return s.key.Public()
+}
+
+// Sign : sign the digest with the wrapped key
+func (s *LocalSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.key.Sign(rand, digest, opts)
+}
+
+// isRawSignKey : keys jwtGo can sign with directly. Everything else signs through crypto.Signer.
+func isRawSignKey(signKey interface{}) bool {
+	switch signKey.(type) {
+	case []byte, *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+		return true
+	}
+
+	return false
+}
+
+// signedStringWithSigner : the crypto.Signer equivalent of token.SignedString
+func signedStringWithSigner(token *jwtGo.Token, signer crypto.Signer) (string, error) {
+	signingString, err := token.SigningString()
+	if err != nil {
+		return "", err
+	}
+
+	signature, err := signWithSigner(signer, token.Method.Alg(), []byte(signingString))
+	if err != nil {
+		return "", err
+	}
+
+	return signingString + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// signWithSigner : sign the message as the given jws alg would, returning the signature in jws form
+func signWithSigner(signer crypto.Signer, alg string, message []byte) ([]byte, error) {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	case "EdDSA":
+		// ed25519 signs the message itself
+		return signer.Sign(rand.Reader, message, crypto.Hash(0))
+	default:
+		return nil, errors.New("signing method cannot be used with a crypto.Signer")
+	}
+
+	hasher := hash.New()
+	hasher.Write(message)
+	digest := hasher.Sum(nil)
+
+	switch alg[:2] {
+	case "RS":
+		return signer.Sign(rand.Reader, digest, hash)
+
+	case "PS":
+		return signer.Sign(rand.Reader, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash})
+	}
+
+	// crypto.Signer returns ASN.1 DER encoded ECDSA signatures, jws wants r || s
+	publicKey, ok := signer.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("signer does not hold an ecdsa key")
+	}
+
+	der, err := signer.Sign(rand.Reader, digest, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	var sig struct {
+		R, S *big.Int
+	}
+	rest, err := asn1.Unmarshal(der, &sig)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 || sig.R == nil || sig.S == nil {
+		return nil, errors.New("invalid ecdsa signature from signer")
+	}
+
+	keySize := (publicKey.Curve.Params().BitSize + 7) / 8
+	if sig.R.BitLen() > keySize*8 || sig.S.BitLen() > keySize*8 {
+		return nil, errors.New("invalid ecdsa signature from signer")
+	}
+
+	signature := make([]byte, 2*keySize)
+	sig.R.FillBytes(signature[:keySize])
+	sig.S.FillBytes(signature[keySize:])
+
+	return signature, nil
+}
@@ -0,0 +1,174 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
+)
+
+// failingSigner : a signer whose backend (e.g. a KMS) can be made unavailable
+type failingSigner struct {
+	crypto.Signer
+	fail bool
+}
+
+func (s *failingSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if s.fail {
+		return nil, errors.New("signing backend is unavailable")
+	}
+	return s.Signer.Sign(rand, digest, opts)
+}
+
+func TestSignWithSigner(t *testing.T) {
+	signBytes, err := ioutil.ReadFile("test/priv.rsa")
+	if err != nil {
+		t.Fatalf("Unable to read RSA private key file: %v", err)
+	}
+	rsaKey, err := jwtGo.ParseRSAPrivateKeyFromPEM(signBytes)
+	if err != nil {
+		t.Fatalf("Unable to parse RSA private key: %v", err)
+	}
+	ecKey256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate ECDSA key: %v", err)
+	}
+	ecKey521, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate ECDSA key: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate EdDSA key: %v", err)
+	}
+
+	var signerTests = []struct {
+		alg string
+		key crypto.Signer
+	}{
+		{"RS256", rsaKey},
+		{"RS512", rsaKey},
+		{"PS256", rsaKey},
+		{"PS384", rsaKey},
+		{"ES256", ecKey256},
+		{"ES512", ecKey521},
+		{"EdDSA", edKey},
+	}
+
+	for idx, test := range signerTests {
+		var a Auth
+		authErr := New(&a, Options{
+			SigningMethodString: test.alg,
+			Signer:              NewLocalSigner(test.key),
+		})
+		if authErr != nil {
+			t.Errorf("Unable to build jwt auth for testing; idx: %d; Err: %v", idx, authErr)
+			continue
+		}
+
+		var c credentials
+		var claims ClaimsType
+		claims.CustomClaims = map[string]interface{}{"foo": "bar"}
+		if err := a.buildCredentialsFromClaims(&c, &claims); err != nil {
+			t.Errorf("Unable to build credentials; idx: %d; Err: %v", idx, err)
+		}
+		tokenString, signErr := a.signToken(c.AuthToken.Token)
+		if signErr != nil {
+			t.Errorf("Unable to sign auth token; idx: %d; Err: %v", idx, signErr)
+			continue
+		}
+
+		// tokens signed through the signer must verify with the public half alone
+		var verify credentials
+		if err := a.buildCredentialsFromStrings(c.CsrfString, tokenString, "", &verify); err != nil {
+			t.Errorf("Unable to build credentials; idx: %d; Err: %v", idx, err)
+		}
+		if verify.AuthToken.ParseErr != nil {
+			t.Errorf("Unable to verify token signed by a crypto.Signer; idx: %d; alg: %s; Err: %v", idx, test.alg, verify.AuthToken.ParseErr)
+		}
+	}
+
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString: "ES256",
+		Signer:              NewLocalSigner(rsaKey),
+	})
+	if authErr == nil {
+		t.Error("Expected an error when the signer does not hold a key for the signing method")
+	}
+
+	authErr = New(&a, Options{
+		SigningMethodString: "HS256",
+		HMACKey:             []byte("test key"),
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+	if err := a.AddKey("signer", NewLocalSigner(ecKey256), []byte("test key")); err == nil {
+		t.Error("Expected an error when adding a crypto.Signer to an HMAC keyring")
+	}
+}
+
+func TestSignerErrorHandler(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate ECDSA key: %v", err)
+	}
+	signer := &failingSigner{Signer: NewLocalSigner(ecKey)}
+
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString: "ES256",
+		Signer:              signer,
+		IsDevEnv:            true,
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+	a.SetErrorHandler(myErrorHandler)
+
+	var c credentials
+	var claims ClaimsType
+	if err := a.buildCredentialsFromClaims(&c, &claims); err != nil {
+		t.Errorf("Unable to build credentials; Err: %v", err)
+	}
+	authTokenString, signErr := a.signToken(c.AuthToken.Token)
+	if signErr != nil {
+		t.Fatalf("Unable to sign auth token; Err: %v", signErr)
+	}
+
+	req, reqErr := http.NewRequest("GET", "http://localhost:8080/", nil)
+	if reqErr != nil {
+		t.Fatalf("Error building request for testing; err: %v", reqErr)
+	}
+	req.AddCookie(&http.Cookie{Name: a.options.AuthTokenName, Value: authTokenString})
+	req.Header.Add(a.options.CSRFTokenName, c.CsrfString)
+
+	// the tokens are re-signed on the way out, which fails while the backend is unavailable
+	signer.fail = true
+	w := httptest.NewRecorder()
+	a.Handler(myHandlerFunc).ServeHTTP(w, req)
+	if w.Code != 501 {
+		t.Errorf("Expected signing errors to be handled by the error handler; Expected: %d; Received: %d", 501, w.Code)
+	}
+
+	if err := a.IssueNewTokens(httptest.NewRecorder(), &claims); err == nil {
+		t.Error("Expected an error issuing tokens while the signing backend is unavailable")
+	}
+
+	signer.fail = false
+	w = httptest.NewRecorder()
+	a.Handler(myHandlerFunc).ServeHTTP(w, req)
+	if w.Code != 200 || w.Body.String() != "In Handler Func" {
+		t.Errorf("Expected the request to succeed once the signing backend is back; Received: %d %s", w.Code, w.Body.String())
+	}
+}
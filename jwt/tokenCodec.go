@@ -0,0 +1,153 @@
+package jwt
+
+import (
+	"crypto"
+	"errors"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
+)
+
+// tokenCodec : turns tokens into the strings handed to clients, and back. Tokens are held as
+// a *jwtGo.Token whatever their format, so the credentials flow doesn't depend on it.
+type tokenCodec interface {
+	// encode : sign (and encrypt, if enabled) the token with the key pair of entry
+	encode(token *jwtGo.Token, entry keyringEntry) (string, error)
+
+	// decode : verify the token string with verifyKey (a key, or a keyResolver) and read its
+	// claims. Like jwtGo.ParseWithClaims, the token may be returned along with a validation error.
+	decode(tokenString string, verifyKey interface{}) (*jwtGo.Token, error)
+}
+
+// buildTokenCodec : the codec of the configured token format. Paseto tokens only come with
+// one kind of key each, so the signing method follows from the format.
+func (o *Options) buildTokenCodec() (tokenCodec, error) {
+	switch o.TokenFormat {
+	case "", "jwt":
+		codec := &jwtCodec{
+			signingMethodString:   o.SigningMethodString,
+			acceptSigningMethods:  o.AcceptSigningMethods,
+			embedCertificateChain: o.EmbedCertificateChain,
+			parserOptions:         o.parserOptions(),
+			flattenCustomClaims:   o.FlattenCustomClaims,
+		}
+		if o.TokenEncryption != "" {
+			var err error
+			codec.encryption, err = newTokenEncryption(o)
+			if err != nil {
+				return nil, err
+			}
+		} else if len(o.TokenEncryptionKey) > 0 || o.TokenDecryptionKey != nil {
+			return nil, errors.New("token encryption keys require a TokenEncryption")
+		}
+
+		return codec, nil
+
+	case pasetoV4Public, pasetoV4Local:
+		codec := &pasetoCodec{purpose: o.TokenFormat, parserOptions: o.parserOptions(), flattenCustomClaims: o.FlattenCustomClaims}
+		if o.SigningMethodString == "" {
+			o.SigningMethodString = codec.signingMethodString()
+		}
+		if o.SigningMethodString != codec.signingMethodString() {
+			return nil, errors.New(o.TokenFormat + " tokens require the " + codec.signingMethodString() + " signing method")
+		}
+		if len(o.AcceptSigningMethods) > 0 || o.TokenEncryption != "" || o.EmbedCertificateChain {
+			return nil, errors.New("AcceptSigningMethods, TokenEncryption and EmbedCertificateChain only apply to jwts")
+		}
+		if o.TokenFormat == pasetoV4Local && len(o.HMACKey) > 0 && len(o.HMACKey) != pasetoLocalKeySize {
+			return nil, errors.New("v4.local tokens require a 32 byte HMACKey")
+		}
+
+		return codec, nil
+	}
+
+	return nil, errors.New("token format not recognized, use \"jwt\", \"v4.public\" or \"v4.local\"")
+}
+
+// parserOptions : how the claims of incoming tokens are validated, whatever their format
+func (o *Options) parserOptions() []jwtGo.ParserOption {
+	options := []jwtGo.ParserOption{jwtGo.WithLeeway(o.Leeway)}
+	if o.Issuer != "" {
+		options = append(options, jwtGo.WithIssuer(o.Issuer))
+	}
+	if o.Audience != "" {
+		options = append(options, jwtGo.WithAudience(o.Audience))
+	}
+
+	return options
+}
+
+// jwtCodec : tokens as signed jwts, optionally wrapped in a jwe
+type jwtCodec struct {
+	signingMethodString   string
+	acceptSigningMethods  []string
+	embedCertificateChain bool
+	encryption            *tokenEncryption
+	parserOptions         []jwtGo.ParserOption
+	flattenCustomClaims   bool
+}
+
+func (c *jwtCodec) encode(token *jwtGo.Token, entry keyringEntry) (string, error) {
+	tokenString, err := signJWT(token, entry, c.embedCertificateChain)
+	if err != nil || c.encryption == nil {
+		return tokenString, err
+	}
+
+	return c.encryption.encrypt(tokenString)
+}
+
+func (c *jwtCodec) decode(tokenString string, verifyKey interface{}) (*jwtGo.Token, error) {
+	// encrypted tokens are decrypted before they're verified, and plain ones are refused
+	if c.encryption != nil {
+		var err error
+		tokenString, err = c.encryption.decrypt(tokenString)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return jwtGo.ParseWithClaims(tokenString, &ClaimsType{flattenCustomClaims: c.flattenCustomClaims}, func(token *jwtGo.Token) (interface{}, error) {
+		if !c.acceptsSigningMethod(token.Method) {
+			return nil, ErrWrongSigningMethod
+		}
+		if resolver, ok := verifyKey.(keyResolver); ok {
+			return resolver.verifyKeyForToken(token)
+		}
+		return verifyKey, nil
+	}, c.parserOptions...)
+}
+
+// acceptsSigningMethod : only the configured signing method is accepted, unless others have
+// been explicitly allowed. e.g. a PS256 token must not verify on an RS256 server by default.
+func (c *jwtCodec) acceptsSigningMethod(method jwtGo.SigningMethod) bool {
+	if method == jwtGo.GetSigningMethod(c.signingMethodString) {
+		return true
+	}
+
+	for _, accepted := range c.acceptSigningMethods {
+		if method == jwtGo.GetSigningMethod(accepted) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// signJWT : sign with the given key pair, stamping its kid (and certificate) into the header
+func signJWT(token *jwtGo.Token, entry keyringEntry, embedCertificateChain bool) (string, error) {
+	if entry.kid != "" {
+		token.Header["kid"] = entry.kid
+	}
+	if len(entry.certificates) > 0 {
+		token.Header["x5t#S256"] = certificateThumbprint(entry.certificates[0])
+		if embedCertificateChain {
+			token.Header["x5c"] = encodeCertificateChain(entry.certificates)
+		}
+	}
+
+	// keys held outside of the process (e.g. in a KMS) sign through crypto.Signer
+	if signer, ok := entry.signKey.(crypto.Signer); ok && !isRawSignKey(entry.signKey) {
+		return signedStringWithSigner(token, signer)
+	}
+
+	return token.SignedString(entry.signKey)
+}
@@ -0,0 +1,72 @@
+package jwt
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName : the instrumentation scope of the spans of the middleware
+const tracerName = "github.com/Lioric/jwt-auth/jwt"
+
+// span attributes
+const (
+	attributeOutcome   = "jwt.outcome"
+	attributeReason    = "jwt.reason"
+	attributeRefreshed = "jwt.refreshed"
+	attributeTokenUse  = "jwt.token_use"
+	attributeValid     = "jwt.valid"
+)
+
+// tracer : the tracer of the TracerProvider of the options, or of the global one
+func tracer(provider trace.TracerProvider) trace.Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(tracerName)
+}
+
+func (a *Auth) tracer() trace.Tracer {
+	return tracer(a.options.TracerProvider)
+}
+
+func (c *credentials) tracer() trace.Tracer {
+	return tracer(c.options.TracerProvider)
+}
+
+// context : the context of the request or call the credentials were built for
+func (c *credentials) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// endSpan : end the span, with the reason of the error, if any. Only errors of the server
+// mark the span as failed; refusing a request is the middleware working as intended.
+func endSpan(span trace.Span, err *Error) {
+	if err != nil {
+		span.SetAttributes(attribute.String(attributeReason, err.Reason))
+		if err.Type/100 != 4 {
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	span.End()
+}
+
+// verifyToken : decode and verify a token of the given use, in a span
+func (c *credentials) verifyToken(tokenString string, verifyKey interface{}, validTime time.Duration, use string) *jwtToken {
+	_, span := c.tracer().Start(c.context(), "jwt.verify", trace.WithAttributes(attribute.String(attributeTokenUse, use)))
+	defer span.End()
+
+	token := c.buildTokenWithClaimsFromString(tokenString, verifyKey, validTime)
+	_, typed := c.codec().(*jwtCodec)
+	token.checkTokenUse(use, typed)
+	span.SetAttributes(attribute.Bool(attributeValid, token.Token.Valid))
+
+	return token
+}
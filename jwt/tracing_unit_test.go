@@ -0,0 +1,111 @@
+package jwt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	var a Auth
+	authErr := New(&a, Options{
+		SigningMethodString: "HS256",
+		HMACKey:             []byte("test key"),
+		BearerTokens:        true,
+		UpdateTokenClaims:   func(claims *ClaimsType) ClaimsType { return *claims },
+		TracerProvider:      provider,
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+
+	// the spans of issuing the tokens are children of the span of the caller
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "login")
+	w := httptest.NewRecorder()
+	if err := a.IssueNewTokensContext(ctx, w, &ClaimsType{}); err != nil {
+		t.Fatalf("Unable to issue tokens; Err: %v", err)
+	}
+	parent.End()
+
+	spans := spansByName(exporter.GetSpans())
+	if spans["jwt.IssueNewTokens"].Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("Expected jwt.IssueNewTokens to be a child of the caller's span")
+	}
+	if spans["jwt.sign"].Parent.SpanID() != spans["jwt.IssueNewTokens"].SpanContext.SpanID() {
+		t.Errorf("Expected jwt.sign to be a child of jwt.IssueNewTokens")
+	}
+
+	csrf := w.Header().Get(a.options.CSRFTokenName)
+	expiredClaims := ClaimsType{Csrf: csrf, TokenUse: tokenUseAccess}
+	expiredClaims.ExpiresAt = jwtGo.NewNumericDate(time.Now().Add(-time.Minute))
+	expiredAuthTokenString, err := a.encodeToken(newAuthTokenWithClaims(jwtGo.SigningMethodHS256, &expiredClaims))
+	if err != nil {
+		t.Fatalf("Unable to sign auth token; Err: %v", err)
+	}
+
+	var tests = []struct {
+		name              string
+		authToken         string
+		csrf              string
+		expectedOutcome   string
+		expectedRefreshed bool
+		expectedChildren  []string
+	}{
+		{"valid token", w.Header().Get(a.options.AuthTokenName), csrf, outcomeAuthorized, false, []string{"jwt.extract", "jwt.verify", "jwt.sign"}},
+		{"expired token", expiredAuthTokenString, csrf, outcomeAuthorized, true, []string{"jwt.extract", "jwt.verify", "jwt.revocation_check", "jwt.update_claims", "jwt.sign"}},
+		{"csrf mismatch", w.Header().Get(a.options.AuthTokenName), "wrong csrf string", "csrf_mismatch", false, []string{"jwt.extract", "jwt.verify"}},
+	}
+
+	for _, test := range tests {
+		exporter.Reset()
+		req, reqErr := http.NewRequest("GET", "http://localhost:8080/", nil)
+		if reqErr != nil {
+			t.Fatalf("Error building request for testing; err: %v", reqErr)
+		}
+		req.Header.Set(a.options.AuthTokenName, test.authToken)
+		req.Header.Set(a.options.RefreshTokenName, w.Header().Get(a.options.RefreshTokenName))
+		req.Header.Set(a.options.CSRFTokenName, test.csrf)
+		if _, err := a.Process(httptest.NewRecorder(), req); (err == nil) != (test.expectedOutcome == outcomeAuthorized) {
+			t.Errorf("[%s] Unexpected result; Err: %v", test.name, err)
+		}
+
+		spans := spansByName(exporter.GetSpans())
+		process, ok := spans["jwt.Process"]
+		if !ok {
+			t.Fatalf("[%s] Expected a jwt.Process span", test.name)
+		}
+		attributes := attribute.NewSet(process.Attributes...)
+		if outcome, _ := attributes.Value(attributeOutcome); outcome.AsString() != test.expectedOutcome {
+			t.Errorf("[%s] Expected outcome %s; Received: %s", test.name, test.expectedOutcome, outcome.AsString())
+		}
+		if refreshed, _ := attributes.Value(attributeRefreshed); refreshed.AsBool() != test.expectedRefreshed {
+			t.Errorf("[%s] Expected refreshed to be %v", test.name, test.expectedRefreshed)
+		}
+
+		for _, name := range test.expectedChildren {
+			child, ok := spans[name]
+			if !ok || child.Parent.SpanID() != process.SpanContext.SpanID() {
+				t.Errorf("[%s] Expected a %s span in jwt.Process", test.name, name)
+			}
+		}
+	}
+}
+
+// spansByName : the spans, by name; the last one of a name wins
+func spansByName(spans tracetest.SpanStubs) map[string]tracetest.SpanStub {
+	byName := make(map[string]tracetest.SpanStub, len(spans))
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+	return byName
+}
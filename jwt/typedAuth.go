@@ -0,0 +1,199 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
+)
+
+// Claims : the claims of a TypedAuth, with the custom claims held in T, a struct of the
+// application. T is carried in the CustomClaims of the tokens, so tokens issued by an Auth
+// and a TypedAuth with the same options can be used with either.
+type Claims[T any] struct {
+	UID      string
+	Csrf     string
+	TokenUse string
+	jwtGo.RegisteredClaims
+	Custom T
+}
+
+// TypedClaimsGenerator : a TokenClaimsGenerator for typed claims
+type TypedClaimsGenerator[T any] func(claims *Claims[T]) Claims[T]
+
+// TypedAuth : an Auth whose custom claims are held in a T, instead of a map
+type TypedAuth[T any] struct {
+	auth Auth
+}
+
+// NewTyped : constructs a new TypedAuth instance with supplied options. Options.UpdateTokenClaims
+// is replaced by the one given with SetUpdateTokenClaimsFunction. Without either, the claims are
+// kept as they are when the tokens are refreshed.
+func NewTyped[T any](auth *TypedAuth[T], o Options) error {
+	return New(&auth.auth, o)
+}
+
+// Auth : the underlying Auth, for everything that doesn't depend on the claims
+// (e.g. the error handlers, key rotation and JWKS)
+func (a *TypedAuth[T]) Auth() *Auth {
+	return &a.auth
+}
+
+// SetUpdateTokenClaimsFunction : set the function which updates the claims when the tokens are refreshed
+func (a *TypedAuth[T]) SetUpdateTokenClaimsFunction(generator TypedClaimsGenerator[T]) {
+	a.auth.options.UpdateTokenClaims = func(claims *ClaimsType) ClaimsType {
+		typed, err := typedClaims[T](claims)
+		if err != nil {
+			// the claims were written from a T when the tokens were issued, so this is unexpected
+			a.auth.log().Error("typed claims cannot be read", "uid", claims.UID, "error", err.Error())
+			return *claims
+		}
+
+		updated := generator(&typed)
+		untyped, err := updated.claimsType()
+		if err != nil {
+			a.auth.log().Error("typed claims cannot be written", "uid", claims.UID, "error", err.Error())
+			return *claims
+		}
+
+		return untyped
+	}
+}
+
+// Handler implements the http.HandlerFunc for integration with the standard net/http lib.
+func (a *TypedAuth[T]) Handler(h http.Handler) http.Handler {
+	return a.auth.Handler(h)
+}
+
+// HandlerFunc works identically to Handler, but takes a HandlerFunc instead of a Handler.
+func (a *TypedAuth[T]) HandlerFunc(fn http.HandlerFunc) http.Handler {
+	return a.auth.HandlerFunc(fn)
+}
+
+// HandlerFuncWithNext is a special implementation for Negroni, but could be used elsewhere.
+func (a *TypedAuth[T]) HandlerFuncWithNext(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	a.auth.HandlerFuncWithNext(w, r, next)
+}
+
+// Process runs the actual checks and returns an error if the middleware chain should stop.
+func (a *TypedAuth[T]) Process(w http.ResponseWriter, r *http.Request) (Claims[T], *Error) {
+	claims, jwtErr := a.auth.Process(w, r)
+	if jwtErr != nil {
+		return Claims[T]{}, jwtErr
+	}
+
+	typed, err := typedClaims[T](&claims)
+	if err != nil {
+		return Claims[T]{}, newJwtError(err, 500)
+	}
+
+	return typed, nil
+}
+
+// IssueNewTokens : issue new auth and refresh tokens and a csrf string for the claims
+func (a *TypedAuth[T]) IssueNewTokens(w http.ResponseWriter, claims *Claims[T]) error {
+	untyped, err := claims.claimsType()
+	if err != nil {
+		return err
+	}
+
+	return a.auth.IssueNewTokens(w, &untyped)
+}
+
+// IssueNewTokensContext : IssueNewTokens, with the spans of issuing the tokens in ctx
+func (a *TypedAuth[T]) IssueNewTokensContext(ctx context.Context, w http.ResponseWriter, claims *Claims[T]) error {
+	untyped, err := claims.claimsType()
+	if err != nil {
+		return err
+	}
+
+	return a.auth.IssueNewTokensContext(ctx, w, &untyped)
+}
+
+// NullifyTokens : invalidate tokens
+func (a *TypedAuth[T]) NullifyTokens(w http.ResponseWriter, r *http.Request) error {
+	return a.auth.NullifyTokens(w, r)
+}
+
+// GrabTokenClaims : extract the claims from the auth token of the request
+func (a *TypedAuth[T]) GrabTokenClaims(r *http.Request) (Claims[T], error) {
+	claims, err := a.auth.GrabTokenClaims(r)
+	if err != nil {
+		return Claims[T]{}, err
+	}
+
+	return typedClaims[T](&claims)
+}
+
+// GrabRefreshTokenClaims : extract the claims from the refresh token of the request
+func (a *TypedAuth[T]) GrabRefreshTokenClaims(r *http.Request) (Claims[T], error) {
+	claims, err := a.auth.GrabRefreshTokenClaims(r)
+	if err != nil {
+		return Claims[T]{}, err
+	}
+
+	return typedClaims[T](&claims)
+}
+
+// TypedClaimsFromContext : ClaimsFromContext, with the custom claims read into a T
+func TypedClaimsFromContext[T any](ctx context.Context) (Claims[T], bool) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return Claims[T]{}, false
+	}
+
+	typed, err := typedClaims[T](&claims)
+	if err != nil {
+		return Claims[T]{}, false
+	}
+
+	return typed, true
+}
+
+// claimsType : the claims with the custom ones written to a map, through their json encoding.
+// Numbers are kept as json.Number, so they're encoded back as they were.
+func (c *Claims[T]) claimsType() (ClaimsType, error) {
+	encoded, err := json.Marshal(c.Custom)
+	if err != nil {
+		return ClaimsType{}, err
+	}
+
+	var customClaims map[string]interface{}
+	if err := unmarshalJSONNumbers(encoded, &customClaims); err != nil {
+		return ClaimsType{}, err
+	}
+
+	return ClaimsType{
+		UID:              c.UID,
+		Csrf:             c.Csrf,
+		TokenUse:         c.TokenUse,
+		RegisteredClaims: c.RegisteredClaims,
+		CustomClaims:     customClaims,
+		customClaimsJSON: encoded,
+	}, nil
+}
+
+// typedClaims : the claims with the custom ones read into a T, from the json they were read from
+// when there is one, so integers above 2^53 don't go through float64
+func typedClaims[T any](claims *ClaimsType) (Claims[T], error) {
+	typed := Claims[T]{
+		UID:              claims.UID,
+		Csrf:             claims.Csrf,
+		TokenUse:         claims.TokenUse,
+		RegisteredClaims: claims.RegisteredClaims,
+	}
+	if claims.CustomClaims == nil {
+		return typed, nil
+	}
+
+	encoded, err := claims.customClaimsEncoding()
+	if err != nil {
+		return Claims[T]{}, err
+	}
+	if err := json.Unmarshal(encoded, &typed.Custom); err != nil {
+		return Claims[T]{}, err
+	}
+
+	return typed, nil
+}
@@ -0,0 +1,221 @@
+package jwt
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwtGo "github.com/golang-jwt/jwt/v5"
+)
+
+type testCustomClaims struct {
+	Role      string   `json:"role"`
+	Level     int      `json:"level"`
+	Groups    []string `json:"groups,omitempty"`
+	Refreshes int      `json:"refreshes"`
+}
+
+func TestTypedAuth(t *testing.T) {
+	var a TypedAuth[testCustomClaims]
+	authErr := NewTyped(&a, Options{
+		SigningMethodString: "HS256",
+		HMACKey:             []byte("test key"),
+		BearerTokens:        true,
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+	a.SetUpdateTokenClaimsFunction(func(claims *Claims[testCustomClaims]) Claims[testCustomClaims] {
+		updated := *claims
+		updated.Custom.Refreshes++
+		return updated
+	})
+
+	claims := Claims[testCustomClaims]{Custom: testCustomClaims{Role: "admin", Level: 3, Groups: []string{"a", "b"}}}
+	claims.Subject = "user"
+	w := httptest.NewRecorder()
+	if err := a.IssueNewTokens(w, &claims); err != nil {
+		t.Fatalf("Unable to issue tokens; Err: %v", err)
+	}
+
+	newRequest := func(authTokenString string) *http.Request {
+		req, reqErr := http.NewRequest("GET", "http://localhost:8080/", nil)
+		if reqErr != nil {
+			t.Fatalf("Error building request for testing; err: %v", reqErr)
+		}
+		req.Header.Set(a.auth.options.AuthTokenName, authTokenString)
+		req.Header.Set(a.auth.options.RefreshTokenName, w.Header().Get(a.auth.options.RefreshTokenName))
+		req.Header.Set(a.auth.options.CSRFTokenName, w.Header().Get(a.auth.options.CSRFTokenName))
+		return req
+	}
+
+	// numbers come back as ints, not float64s
+	processed, jwtErr := a.Process(httptest.NewRecorder(), newRequest(w.Header().Get(a.auth.options.AuthTokenName)))
+	if jwtErr != nil {
+		t.Fatalf("Unable to process request; Err: %v", jwtErr)
+	}
+	if processed.Custom.Role != "admin" || processed.Custom.Level != 3 || len(processed.Custom.Groups) != 2 || processed.Subject != "user" {
+		t.Errorf("Expected the typed claims to be read from the token; Received: %+v", processed)
+	}
+
+	grabbed, err := a.GrabTokenClaims(newRequest(w.Header().Get(a.auth.options.AuthTokenName)))
+	if err != nil || grabbed.Custom.Level != 3 || grabbed.TokenUse != tokenUseAccess {
+		t.Errorf("Expected the typed claims to be grabbed from the token; Err: %v", err)
+	}
+
+	// tokens are refreshed through the typed generator
+	expiredClaims := ClaimsType{Csrf: grabbed.Csrf, TokenUse: tokenUseAccess}
+	expiredClaims.ExpiresAt = jwtGo.NewNumericDate(time.Now().Add(-time.Minute))
+	expiredAuthTokenString, err := a.auth.encodeToken(newAuthTokenWithClaims(jwtGo.SigningMethodHS256, &expiredClaims))
+	if err != nil {
+		t.Fatalf("Unable to sign auth token; Err: %v", err)
+	}
+	refreshed, jwtErr := a.Process(httptest.NewRecorder(), newRequest(expiredAuthTokenString))
+	if jwtErr != nil {
+		t.Fatalf("Unable to process request; Err: %v", jwtErr)
+	}
+	if refreshed.Custom.Refreshes != 1 || refreshed.Custom.Role != "admin" {
+		t.Errorf("Expected the claims to be updated on refresh; Received: %+v", refreshed.Custom)
+	}
+
+	// the tokens are the same as the ones of an Auth
+	untyped, err := a.Auth().GrabTokenClaims(newRequest(w.Header().Get(a.auth.options.AuthTokenName)))
+	if err != nil || untyped.CustomClaims["role"] != "admin" || untyped.CustomClaims["level"] != float64(3) {
+		t.Errorf("Expected the custom claims to be readable as a map; Received: %v", untyped.CustomClaims)
+	}
+}
+
+func TestTypedAuthWithoutUpdateFunction(t *testing.T) {
+	var a TypedAuth[testCustomClaims]
+	authErr := NewTyped(&a, Options{
+		SigningMethodString: "HS256",
+		HMACKey:             []byte("test key"),
+		BearerTokens:        true,
+	})
+	if authErr != nil {
+		t.Fatalf("Unable to build jwt auth for testing; Err: %v", authErr)
+	}
+
+	claims := Claims[testCustomClaims]{Custom: testCustomClaims{Role: "admin", Level: 3}}
+	w := httptest.NewRecorder()
+	if err := a.IssueNewTokens(w, &claims); err != nil {
+		t.Fatalf("Unable to issue tokens; Err: %v", err)
+	}
+
+	grabbedReq, reqErr := http.NewRequest("GET", "http://localhost:8080/", nil)
+	if reqErr != nil {
+		t.Fatalf("Error building request for testing; err: %v", reqErr)
+	}
+	grabbedReq.Header.Set(a.auth.options.AuthTokenName, w.Header().Get(a.auth.options.AuthTokenName))
+	grabbedReq.Header.Set(a.auth.options.CSRFTokenName, w.Header().Get(a.auth.options.CSRFTokenName))
+	grabbed, err := a.GrabTokenClaims(grabbedReq)
+	if err != nil {
+		t.Fatalf("Unable to grab token claims; Err: %v", err)
+	}
+
+	// the expired auth token is refreshed with the claims kept as they are
+	expiredClaims := ClaimsType{Csrf: grabbed.Csrf, TokenUse: tokenUseAccess}
+	expiredClaims.ExpiresAt = jwtGo.NewNumericDate(time.Now().Add(-time.Minute))
+	expiredAuthTokenString, err := a.auth.encodeToken(newAuthTokenWithClaims(jwtGo.SigningMethodHS256, &expiredClaims))
+	if err != nil {
+		t.Fatalf("Unable to sign auth token; Err: %v", err)
+	}
+	req, reqErr := http.NewRequest("GET", "http://localhost:8080/", nil)
+	if reqErr != nil {
+		t.Fatalf("Error building request for testing; err: %v", reqErr)
+	}
+	req.Header.Set(a.auth.options.AuthTokenName, expiredAuthTokenString)
+	req.Header.Set(a.auth.options.RefreshTokenName, w.Header().Get(a.auth.options.RefreshTokenName))
+	req.Header.Set(a.auth.options.CSRFTokenName, w.Header().Get(a.auth.options.CSRFTokenName))
+
+	refreshedW := httptest.NewRecorder()
+	refreshed, jwtErr := a.Process(refreshedW, req)
+	if jwtErr != nil {
+		t.Fatalf("Unable to process request; Err: %v", jwtErr)
+	}
+	if refreshed.Custom.Role != "admin" || refreshed.Custom.Level != 3 || refreshed.Custom.Refreshes != 0 {
+		t.Errorf("Expected the claims to be kept on refresh; Received: %+v", refreshed.Custom)
+	}
+	if refreshedW.Header().Get(a.auth.options.AuthTokenName) == "" {
+		t.Error("Expected a new auth token to be issued on refresh")
+	}
+}
+
+type testPreciseClaims struct {
+	AccountId int64 `json:"account_id"`
+	Org       struct {
+		Id    uint64 `json:"id"`
+		Roles []string
+	} `json:"org"`
+}
+
+func TestTypedAuthPrecision(t *testing.T) {
+	var optionTests = []struct {
+		name    string
+		options Options
+	}{
+		{"jwt", Options{SigningMethodString: "HS256", HMACKey: []byte("test key")}},
+		{"flattened", Options{SigningMethodString: "HS256", HMACKey: []byte("test key"), FlattenCustomClaims: true}},
+		{"paseto", Options{TokenFormat: pasetoV4Local, HMACKey: bytes.Repeat([]byte("k"), 32)}},
+	}
+
+	for _, test := range optionTests {
+		var a TypedAuth[testPreciseClaims]
+		options := test.options
+		options.BearerTokens = true
+		if err := NewTyped(&a, options); err != nil {
+			t.Fatalf("[%s] Unable to build jwt auth for testing; Err: %v", test.name, err)
+		}
+		a.SetUpdateTokenClaimsFunction(func(claims *Claims[testPreciseClaims]) Claims[testPreciseClaims] {
+			return *claims
+		})
+
+		// above 2^53, float64 would round them
+		claims := Claims[testPreciseClaims]{}
+		claims.Custom.AccountId = 9007199254740993
+		claims.Custom.Org.Id = 18446744073709551615
+		claims.Custom.Org.Roles = []string{"owner"}
+		w := httptest.NewRecorder()
+		if err := a.IssueNewTokens(w, &claims); err != nil {
+			t.Fatalf("[%s] Unable to issue tokens; Err: %v", test.name, err)
+		}
+
+		newRequest := func(authTokenString string) *http.Request {
+			req, reqErr := http.NewRequest("GET", "http://localhost:8080/", nil)
+			if reqErr != nil {
+				t.Fatalf("Error building request for testing; err: %v", reqErr)
+			}
+			req.Header.Set(a.auth.options.AuthTokenName, authTokenString)
+			req.Header.Set(a.auth.options.RefreshTokenName, w.Header().Get(a.auth.options.RefreshTokenName))
+			req.Header.Set(a.auth.options.CSRFTokenName, w.Header().Get(a.auth.options.CSRFTokenName))
+			return req
+		}
+
+		processed, jwtErr := a.Process(httptest.NewRecorder(), newRequest(w.Header().Get(a.auth.options.AuthTokenName)))
+		if jwtErr != nil {
+			t.Fatalf("[%s] Unable to process request; Err: %v", test.name, jwtErr)
+		}
+		if processed.Custom.AccountId != claims.Custom.AccountId || processed.Custom.Org.Id != claims.Custom.Org.Id || len(processed.Custom.Org.Roles) != 1 {
+			t.Errorf("[%s] Expected the typed claims to keep their precision; Received: %+v", test.name, processed.Custom)
+		}
+
+		// and so do they through a refresh
+		refreshed, err := a.GrabRefreshTokenClaims(newRequest(""))
+		if err != nil || refreshed.Custom.AccountId != claims.Custom.AccountId || refreshed.Custom.Org.Id != claims.Custom.Org.Id {
+			t.Errorf("[%s] Expected the refresh token claims to keep their precision; Received: %+v, Err: %v", test.name, refreshed.Custom, err)
+		}
+
+		// custom claims changed through the map are read from it, and the others keep their precision
+		untyped, err := a.Auth().GrabTokenClaims(newRequest(w.Header().Get(a.auth.options.AuthTokenName)))
+		if err != nil {
+			t.Fatalf("[%s] Unable to grab claims; Err: %v", test.name, err)
+		}
+		untyped.CustomClaims["account_id"] = 7
+		changed, err := typedClaims[testPreciseClaims](&untyped)
+		if err != nil || changed.Custom.AccountId != 7 || changed.Custom.Org.Id != claims.Custom.Org.Id {
+			t.Errorf("[%s] Expected the changed custom claims to be read; Received: %+v, Err: %v", test.name, changed.Custom, err)
+		}
+	}
+}